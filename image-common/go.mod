@@ -0,0 +1,12 @@
+module image-common
+
+go 1.21.2
+
+require (
+	github.com/aws/aws-sdk-go v1.48.4
+	github.com/rabbitmq/amqp091-go v1.9.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	golang.org/x/image v0.18.0
+)
+
+require github.com/jmespath/go-jmespath v0.4.0 // indirect
@@ -0,0 +1,77 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is wrapped by the errors of Get for keys that don't exist.
+var ErrNotFound = errors.New("blob not found")
+
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+)
+
+// Store keeps the files of both services under keys such as
+// "<imageId>.webp" or "jobs/<jobId>/webp".
+type Store interface {
+	Get(key string) ([]byte, error)
+	// Put replaces the file under key as a whole, readers never see a
+	// partially written one.
+	Put(key string, data []byte) error
+	// Delete succeeds for keys that don't exist.
+	Delete(key string) error
+	Exists(key string) (bool, error)
+	// ModTime is the time the file under key was last written at.
+	ModTime(key string) (time.Time, error)
+	// List returns the keys starting with prefix.
+	List(prefix string) ([]string, error)
+}
+
+type Config struct {
+	Backend string
+	Path    string
+	S3      S3Config
+	// Secondaries are written to after the backend and read from when it is
+	// unavailable, see Replicated.
+	Secondaries []Config
+}
+
+func Open(config Config) (Store, error) {
+	primary, err := openBackend(config)
+
+	if err != nil || len(config.Secondaries) == 0 {
+		return primary, err
+	}
+
+	secondaries := make([]Store, 0, len(config.Secondaries))
+
+	for _, secondaryConfig := range config.Secondaries {
+		secondary, err := openBackend(secondaryConfig)
+
+		if err != nil {
+			return nil, err
+		}
+
+		secondaries = append(secondaries, secondary)
+	}
+
+	return NewReplicated(primary, secondaries...), nil
+}
+
+func openBackend(config Config) (Store, error) {
+	switch config.Backend {
+	case BackendS3:
+		return NewS3Store(config.S3), nil
+	case BackendFilesystem:
+		return NewFileStore(config.Path)
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown storage backend %s", config.Backend))
+	}
+}
+
+func notFound(key string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, key)
+}
@@ -0,0 +1,238 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileStore keeps the files in a local directory, which services on the same
+// host or on a shared volume can use together. Every segment of a key sits in
+// a directory named after its hash so that no directory grows too large:
+// "jobs/<jobId>/webp" is stored as "<root>/8c/jobs/4e/<jobId>/b1/webp".
+type FileStore struct {
+	root string
+}
+
+const tempFilePrefix = ".tmp-"
+
+func NewFileStore(root string) (*FileStore, error) {
+	if root == "" {
+		return nil, errors.New("StoragePath is required for the filesystem storage")
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileStore{root}, nil
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	fileName, err := s.fileName(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(fileName)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, notFound(key)
+	}
+
+	return data, err
+}
+
+// Put writes a temp file next to the target and renames it over the target,
+// a crash leaves either the old or the new file.
+func (s *FileStore) Put(key string, data []byte) error {
+	fileName, err := s.fileName(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(fileName), tempFilePrefix+"*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), fileName)
+}
+
+func (s *FileStore) Delete(key string) error {
+	fileName, err := s.fileName(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(fileName)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *FileStore) Exists(key string) (bool, error) {
+	fileName, err := s.fileName(key)
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(fileName)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *FileStore) ModTime(key string) (time.Time, error) {
+	fileName, err := s.fileName(key)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := os.Stat(fileName)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, notFound(key)
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
+
+// List walks the directory of the part of prefix up to its last "/".
+func (s *FileStore) List(prefix string) ([]string, error) {
+	dir := s.root
+	prefixDir, _ := path.Split(prefix)
+
+	if prefixDir != "" {
+		if err := validateKey(strings.TrimSuffix(prefixDir, "/")); err != nil {
+			return nil, err
+		}
+
+		dir = filepath.Join(s.root, shardedPath(strings.TrimSuffix(prefixDir, "/")))
+	}
+
+	keys := make([]string, 0)
+
+	err := filepath.WalkDir(dir, func(fileName string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return err
+		}
+
+		relative, err := filepath.Rel(s.root, fileName)
+
+		if err != nil {
+			return err
+		}
+
+		if key := keyOf(relative); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *FileStore) fileName(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, shardedPath(key)), nil
+}
+
+// validateKey keeps keys inside the store: no absolute paths, no "." or ".."
+// segments, and no hidden names, which are reserved for temp files.
+func validateKey(key string) error {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return errors.New(fmt.Sprintf("Invalid storage key %q", key))
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return errors.New(fmt.Sprintf("Invalid storage key %q", key))
+		}
+	}
+
+	return nil
+}
+
+func shardedPath(key string) string {
+	segments := strings.Split(key, "/")
+	parts := make([]string, 0, len(segments)*2)
+
+	for _, segment := range segments {
+		sum := sha256.Sum256([]byte(segment))
+		parts = append(parts, hex.EncodeToString(sum[:1]), segment)
+	}
+
+	return filepath.Join(parts...)
+}
+
+// keyOf drops the hash directories from a path relative to the root.
+func keyOf(relative string) string {
+	parts := strings.Split(filepath.ToSlash(relative), "/")
+	segments := make([]string, 0, len(parts)/2)
+
+	for i := 1; i < len(parts); i += 2 {
+		segments = append(segments, parts[i])
+	}
+
+	return strings.Join(segments, "/")
+}
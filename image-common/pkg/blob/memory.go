@@ -0,0 +1,96 @@
+package blob
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps the files in the process, for development and tests. Nothing
+// survives a restart.
+type Memory struct {
+	mu    sync.Mutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		files: make(map[string]memoryFile),
+	}
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[key]
+
+	if !ok {
+		return nil, notFound(key)
+	}
+
+	return append([]byte{}, file.data...), nil
+}
+
+func (m *Memory) Put(key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[key] = memoryFile{append([]byte{}, data...), time.Now()}
+
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, key)
+
+	return nil
+}
+
+func (m *Memory) Exists(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.files[key]
+
+	return ok, nil
+}
+
+func (m *Memory) ModTime(key string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[key]
+
+	if !ok {
+		return time.Time{}, notFound(key)
+	}
+
+	return file.modTime, nil
+}
+
+func (m *Memory) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0)
+
+	for key := range m.files {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
@@ -0,0 +1,205 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	repairDelay   = 30 * time.Second
+	maxRepairKeys = 10000
+)
+
+// Replicated writes to the primary store then to every secondary, and reads
+// from the secondaries in turn when the primary is unavailable. A write that
+// fails on a secondary succeeds: the key is queued and the secondary is
+// brought up to date with the primary later on. The queue is kept in memory,
+// the storage migration repairs what is lost with a restart.
+type Replicated struct {
+	primary     Store
+	secondaries []Store
+	mu          sync.Mutex
+	repairs     map[repair]bool
+	scheduled   bool
+}
+
+type repair struct {
+	secondary int
+	key       string
+}
+
+func NewReplicated(primary Store, secondaries ...Store) *Replicated {
+	return &Replicated{
+		primary:     primary,
+		secondaries: secondaries,
+		repairs:     make(map[repair]bool),
+	}
+}
+
+// Get only falls back to the secondaries when the primary fails, a file the
+// primary doesn't have is not found.
+func (r *Replicated) Get(key string) ([]byte, error) {
+	data, err := r.primary.Get(key)
+
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+
+	for _, secondary := range r.secondaries {
+		if secondaryData, secondaryErr := secondary.Get(key); secondaryErr == nil {
+			return secondaryData, nil
+		}
+	}
+
+	return nil, err
+}
+
+func (r *Replicated) Put(key string, data []byte) error {
+	if err := r.primary.Put(key, data); err != nil {
+		return err
+	}
+
+	for i, secondary := range r.secondaries {
+		if err := secondary.Put(key, data); err != nil {
+			r.queueRepair(i, key, err)
+		}
+	}
+
+	return nil
+}
+
+// Delete fails when the primary does, failures of the secondaries are
+// repaired like the ones of Put.
+func (r *Replicated) Delete(key string) error {
+	if err := r.primary.Delete(key); err != nil {
+		return err
+	}
+
+	for i, secondary := range r.secondaries {
+		if err := secondary.Delete(key); err != nil {
+			r.queueRepair(i, key, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Replicated) Exists(key string) (bool, error) {
+	exists, err := r.primary.Exists(key)
+
+	if err == nil {
+		return exists, nil
+	}
+
+	for _, secondary := range r.secondaries {
+		if secondaryExists, secondaryErr := secondary.Exists(key); secondaryErr == nil {
+			return secondaryExists, nil
+		}
+	}
+
+	return false, err
+}
+
+func (r *Replicated) ModTime(key string) (time.Time, error) {
+	modTime, err := r.primary.ModTime(key)
+
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return modTime, err
+	}
+
+	for _, secondary := range r.secondaries {
+		if secondaryModTime, secondaryErr := secondary.ModTime(key); secondaryErr == nil {
+			return secondaryModTime, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+// List only lists the primary, which has every file the secondaries have.
+func (r *Replicated) List(prefix string) ([]string, error) {
+	return r.primary.List(prefix)
+}
+
+// PendingRepairs is the number of writes to the secondaries waiting to be
+// repaired.
+func (r *Replicated) PendingRepairs() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.repairs)
+}
+
+// Repair copies the files of the queued keys from the primary to the
+// secondaries they failed on, or deletes them there when the primary doesn't
+// have them anymore. Keys that fail again stay queued.
+func (r *Replicated) Repair() {
+	r.mu.Lock()
+	repairs := make([]repair, 0, len(r.repairs))
+
+	for queued := range r.repairs {
+		repairs = append(repairs, queued)
+	}
+
+	r.mu.Unlock()
+
+	for _, queued := range repairs {
+		if err := r.repair(queued); err != nil {
+			fmt.Println(fmt.Sprintf("Failed to repair %s on secondary storage %d: %s", queued.key, queued.secondary+1, err))
+			continue
+		}
+
+		r.mu.Lock()
+		delete(r.repairs, queued)
+		r.mu.Unlock()
+	}
+}
+
+func (r *Replicated) repair(queued repair) error {
+	secondary := r.secondaries[queued.secondary]
+	data, err := r.primary.Get(queued.key)
+
+	if errors.Is(err, ErrNotFound) {
+		return secondary.Delete(queued.key)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return secondary.Put(queued.key, data)
+}
+
+func (r *Replicated) queueRepair(secondary int, key string, err error) {
+	fmt.Println(fmt.Sprintf("Failed to write %s to secondary storage %d, queued for repair: %s", key, secondary+1, err))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.repairs) >= maxRepairKeys {
+		fmt.Println(fmt.Sprintf("Too many writes to repair, run migrate-storage to copy %s", key))
+		return
+	}
+
+	r.repairs[repair{secondary, key}] = true
+
+	if !r.scheduled {
+		r.scheduled = true
+		time.AfterFunc(repairDelay, r.runScheduledRepair)
+	}
+}
+
+func (r *Replicated) runScheduledRepair() {
+	r.Repair()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.scheduled = len(r.repairs) > 0
+
+	if r.scheduled {
+		time.AfterFunc(repairDelay, r.runScheduledRepair)
+	}
+}
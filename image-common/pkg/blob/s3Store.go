@@ -0,0 +1,148 @@
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+type S3Config struct {
+	Bucket          string
+	AccessKeyId     string
+	SecretAccessKey string
+	Endpoint        string
+}
+
+type S3Store struct {
+	s3Client   *s3.S3
+	s3Uploader *s3manager.Uploader
+	bucketName string
+}
+
+func NewS3Store(s3Config S3Config) *S3Store {
+	awsConfig := aws.NewConfig()
+	awsConfig.Endpoint = &s3Config.Endpoint
+	awsConfig.Region = aws.String("us-east-2")
+	awsConfig.S3ForcePathStyle = aws.Bool(true)
+	awsConfig.Credentials = credentials.NewStaticCredentials(
+		s3Config.AccessKeyId,
+		s3Config.SecretAccessKey,
+		"",
+	)
+
+	sess := session.Must(session.NewSession(awsConfig))
+
+	return &S3Store{
+		s3.New(sess, awsConfig),
+		s3manager.NewUploader(sess),
+		s3Config.Bucket,
+	}
+}
+
+func (s *S3Store) Get(key string) ([]byte, error) {
+	getObjectOutput, err := s.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	var awsErr awserr.Error
+
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, notFound(key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer getObjectOutput.Body.Close()
+
+	return io.ReadAll(getObjectOutput.Body)
+}
+
+func (s *S3Store) Put(key string, data []byte) error {
+	_, err := s.s3Uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+
+	return err
+}
+
+func (s *S3Store) Delete(key string) error {
+	_, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+func (s *S3Store) Exists(key string) (bool, error) {
+	_, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if isNotFoundStatus(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *S3Store) ModTime(key string) (time.Time, error) {
+	headObjectOutput, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if isNotFoundStatus(err) {
+		return time.Time{}, notFound(key)
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return aws.TimeValue(headObjectOutput.LastModified), nil
+}
+
+func (s *S3Store) List(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+
+	err := s.s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// isNotFoundStatus reads the errors of HEAD requests, which have no body: a
+// missing key only shows in the status.
+func isNotFoundStatus(err error) bool {
+	var requestErr awserr.RequestFailure
+
+	return errors.As(err, &requestErr) && requestErr.StatusCode() == http.StatusNotFound
+}
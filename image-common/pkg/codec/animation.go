@@ -0,0 +1,218 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"io"
+	"time"
+)
+
+const (
+	AnimationPreserve = "preserve"
+	AnimationPoster   = "poster"
+)
+
+// Animation keeps every frame fully composed, so frames can be transformed
+// independently and re-encoded by any animated codec. LoopCount is the number
+// of times the animation plays, 0 means forever.
+type Animation struct {
+	Frames    []image.Image
+	Delays    []time.Duration
+	LoopCount int
+}
+
+func (a *Animation) Duration() time.Duration {
+	var duration time.Duration
+
+	for _, delay := range a.Delays {
+		duration += delay
+	}
+
+	return duration
+}
+
+type AnimatedCodec interface {
+	Codec
+	DecodeAll(r io.Reader) (*Animation, error)
+	EncodeAll(w io.Writer, animation *Animation, options EncodeOptions) error
+}
+
+// AnimationInfo is read from the blocks of a file without decoding the
+// frames, so that an animation too large to decode is refused beforehand.
+type AnimationInfo struct {
+	Width    int
+	Height   int
+	Frames   int
+	Duration time.Duration
+}
+
+func (a AnimationInfo) IsAnimated() bool {
+	return a.Frames > 1
+}
+
+// Megapixels is the size of the animation once every frame is composed.
+func (a AnimationInfo) Megapixels() float64 {
+	return float64(a.Width) * float64(a.Height) * float64(a.Frames) / 1e6
+}
+
+// ScanAnimation reports a single frame for the formats that can't be animated.
+func ScanAnimation(format Format, file []byte) (AnimationInfo, error) {
+	switch format.Name {
+	case Gif.Name:
+		return scanGif(file)
+	case Webp.Name:
+		return scanWebp(file)
+	default:
+		return AnimationInfo{Frames: 1}, nil
+	}
+}
+
+func IsAnimated(format Format, file []byte) bool {
+	info, err := ScanAnimation(format, file)
+	return err == nil && info.IsAnimated()
+}
+
+var errMalformedGif = errors.New("Malformed gif file")
+
+// scanGif walks the blocks of the file, skipping the compressed image data,
+// and adds up the delays of the graphic control extensions like
+// gif.DecodeAll does.
+func scanGif(file []byte) (AnimationInfo, error) {
+	config, err := gif.DecodeConfig(bytes.NewReader(file))
+
+	if err != nil {
+		return AnimationInfo{}, err
+	}
+
+	info := AnimationInfo{Width: config.Width, Height: config.Height}
+
+	// header and logical screen descriptor
+	if len(file) < 13 {
+		return info, errMalformedGif
+	}
+
+	pos := 13
+
+	if file[10]&0x80 != 0 {
+		pos += 3 * (1 << (file[10]&0x07 + 1))
+	}
+
+	delay := 0
+
+	for {
+		if pos >= len(file) {
+			return info, errMalformedGif
+		}
+
+		block := file[pos]
+		pos++
+
+		switch block {
+		case 0x21:
+			if pos >= len(file) {
+				return info, errMalformedGif
+			}
+
+			label := file[pos]
+			pos++
+
+			if label == 0xF9 && pos+4 <= len(file) && file[pos] >= 4 {
+				delay = int(binary.LittleEndian.Uint16(file[pos+2 : pos+4]))
+			}
+
+			if pos, err = skipGifSubBlocks(file, pos); err != nil {
+				return info, err
+			}
+		case 0x2C:
+			if pos+9 > len(file) {
+				return info, errMalformedGif
+			}
+
+			packed := file[pos+8]
+			pos += 9
+
+			if packed&0x80 != 0 {
+				pos += 3 * (1 << (packed&0x07 + 1))
+			}
+
+			// LZW minimum code size
+			pos++
+
+			if pos, err = skipGifSubBlocks(file, pos); err != nil {
+				return info, err
+			}
+
+			info.Frames++
+			info.Duration += time.Duration(delay) * 10 * time.Millisecond
+			delay = 0
+		case 0x3B:
+			return info, nil
+		default:
+			return info, errMalformedGif
+		}
+	}
+}
+
+func skipGifSubBlocks(file []byte, pos int) (int, error) {
+	for {
+		if pos >= len(file) {
+			return pos, errMalformedGif
+		}
+
+		size := int(file[pos])
+		pos += 1 + size
+
+		if size == 0 {
+			return pos, nil
+		}
+	}
+}
+
+var errMalformedWebp = errors.New("Malformed webp file")
+
+// scanWebp reads the canvas size from the VP8X chunk and counts the ANMF
+// chunks, each starting with the position, size and duration of a frame.
+func scanWebp(file []byte) (AnimationInfo, error) {
+	if len(file) < 12 || string(file[0:4]) != "RIFF" || string(file[8:12]) != "WEBP" {
+		return AnimationInfo{}, errMalformedWebp
+	}
+
+	info := AnimationInfo{}
+
+	for pos := 12; pos+8 <= len(file); {
+		chunk := string(file[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(file[pos+4 : pos+8]))
+		data := file[pos+8:]
+
+		if size > len(data) {
+			return info, errMalformedWebp
+		}
+
+		data = data[:size]
+
+		switch {
+		case chunk == "VP8X" && size >= 10:
+			info.Width = int(uint24(data[4:7])) + 1
+			info.Height = int(uint24(data[7:10])) + 1
+		case chunk == "ANMF" && size >= 16:
+			info.Frames++
+			info.Duration += time.Duration(uint24(data[12:15])) * time.Millisecond
+		}
+
+		// chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+
+	if info.Frames == 0 {
+		info.Frames = 1
+	}
+
+	return info, nil
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
@@ -0,0 +1,134 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image-common/pkg/codec"
+	"testing"
+	"time"
+)
+
+func encodeTestGif(t *testing.T, animation *codec.Animation) []byte {
+	var buf bytes.Buffer
+
+	if err := codec.NewGifCodec().EncodeAll(&buf, animation, codec.EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// newTestWebp builds the chunks of an animated webp, the frames themselves
+// are left empty since only the headers are read.
+func newTestWebp(width int, height int, durations ...int) []byte {
+	var chunks bytes.Buffer
+
+	writeChunk := func(name string, data []byte) {
+		chunks.WriteString(name)
+		binary.Write(&chunks, binary.LittleEndian, uint32(len(data)))
+		chunks.Write(data)
+
+		if len(data)%2 == 1 {
+			chunks.WriteByte(0)
+		}
+	}
+
+	putUint24 := func(b []byte, v int) {
+		b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02
+	putUint24(vp8x[4:], width-1)
+	putUint24(vp8x[7:], height-1)
+	writeChunk("VP8X", vp8x)
+	writeChunk("ANIM", make([]byte, 6))
+
+	for _, duration := range durations {
+		anmf := make([]byte, 17)
+		putUint24(anmf[12:], duration)
+		writeChunk("ANMF", anmf)
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(4+chunks.Len()))
+	file.WriteString("WEBP")
+	file.Write(chunks.Bytes())
+
+	return file.Bytes()
+}
+
+func TestScanAnimation(t *testing.T) {
+	still := encodeTestGif(t, newTestAnimation(1, 0))
+	animated := encodeTestGif(t, newTestAnimation(30, 0))
+
+	tests := []struct {
+		name     string
+		format   codec.Format
+		file     []byte
+		expected codec.AnimationInfo
+	}{
+		{"StillGif", codec.Gif, still, codec.AnimationInfo{Width: 4, Height: 4, Frames: 1, Duration: 100 * time.Millisecond}},
+		{"AnimatedGif", codec.Gif, animated, codec.AnimationInfo{Width: 4, Height: 4, Frames: 30, Duration: 3 * time.Second}},
+		{"AnimatedWebp", codec.Webp, newTestWebp(640, 480, 40, 40, 120), codec.AnimationInfo{Width: 640, Height: 480, Frames: 3, Duration: 200 * time.Millisecond}},
+		{"Png", codec.Png, []byte("not read"), codec.AnimationInfo{Frames: 1}},
+	}
+
+	for _, test := range tests {
+		info, err := codec.ScanAnimation(test.format, test.file)
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if info != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, info)
+		}
+
+		if codec.IsAnimated(test.format, test.file) != (test.expected.Frames > 1) {
+			t.Errorf("%s: expected animated %v", test.name, test.expected.Frames > 1)
+		}
+	}
+
+	info, _ := codec.ScanAnimation(codec.Gif, animated)
+
+	if info.Megapixels() != 4*4*30/1e6 {
+		t.Errorf("expected the pixels of every frame, got %g megapixels", info.Megapixels())
+	}
+}
+
+func TestScanAnimationRejectsMalformedFiles(t *testing.T) {
+	animated := encodeTestGif(t, newTestAnimation(3, 0))
+	webp := newTestWebp(64, 64, 100, 100)
+
+	tests := []struct {
+		name   string
+		format codec.Format
+		file   []byte
+	}{
+		{"TruncatedGif", codec.Gif, animated[:len(animated)-10]},
+		{"GifWithoutTrailer", codec.Gif, animated[:len(animated)-1]},
+		{"UnknownGifBlock", codec.Gif, append(append([]byte{}, animated[:len(animated)-1]...), 0x99)},
+		{"TruncatedWebp", codec.Webp, webp[:len(webp)-4]},
+		{"NotWebp", codec.Webp, []byte("RIFF0000WAVE")},
+	}
+
+	for _, test := range tests {
+		if _, err := codec.ScanAnimation(test.format, test.file); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestGifDecodeReadsFirstFrame(t *testing.T) {
+	img, err := codec.NewGifCodec().Decode(bytes.NewReader(encodeTestGif(t, newTestAnimation(3, 0))))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 4 {
+		t.Errorf("expected the canvas size, got %s", img.Bounds().Size())
+	}
+}
@@ -0,0 +1,140 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformedAvif = errors.New("Malformed avif file")
+
+// isAvif tells an AVIF file from its ftyp box, by the major or a compatible
+// brand.
+func isAvif(file []byte) bool {
+	if len(file) < 16 || string(file[4:8]) != "ftyp" {
+		return false
+	}
+
+	size := int(binary.BigEndian.Uint32(file))
+
+	if size < 16 || size > len(file) {
+		return false
+	}
+
+	// major brand, minor version, then the compatible brands
+	for pos := 8; pos+4 <= size; pos += 4 {
+		if pos == 12 {
+			continue
+		}
+
+		if brand := string(file[pos : pos+4]); brand == "avif" || brand == "avis" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// avifSize reads the image spatial extents ('ispe') of the items and the
+// track headers of image sequences. Thumbnails, alpha planes and grid tiles
+// have their own, the largest of them bounds the image that is decoded.
+func avifSize(file []byte) (width int, height int, err error) {
+	grow := func(w uint32, h uint32) {
+		width, height = max(width, int(w)), max(height, int(h))
+	}
+
+	err = forEachBox(file, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "meta":
+			// a full box, with a version and flags first
+			if len(payload) < 4 {
+				return errMalformedAvif
+			}
+
+			return findBox(payload[4:], []string{"iprp", "ipco", "ispe"}, func(ispe []byte) error {
+				if len(ispe) < 12 {
+					return errMalformedAvif
+				}
+
+				grow(binary.BigEndian.Uint32(ispe[4:]), binary.BigEndian.Uint32(ispe[8:]))
+				return nil
+			})
+		case "moov":
+			return findBox(payload, []string{"trak", "tkhd"}, func(tkhd []byte) error {
+				// width and height end the box, as 16.16 fixed-point numbers
+				if len(tkhd) < 8 {
+					return errMalformedAvif
+				}
+
+				size := tkhd[len(tkhd)-8:]
+				grow(binary.BigEndian.Uint32(size)>>16, binary.BigEndian.Uint32(size[4:])>>16)
+				return nil
+			})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if width == 0 || height == 0 {
+		return 0, 0, ErrUnknownSize
+	}
+
+	return width, height, nil
+}
+
+// findBox calls visit with the payload of every box at path under data.
+func findBox(data []byte, path []string, visit func(payload []byte) error) error {
+	return forEachBox(data, func(boxType string, payload []byte) error {
+		switch {
+		case boxType != path[0]:
+			return nil
+		case len(path) == 1:
+			return visit(payload)
+		default:
+			return findBox(payload, path[1:], visit)
+		}
+	})
+}
+
+// forEachBox walks the ISOBMFF boxes of data, without descending into them.
+func forEachBox(data []byte, visit func(boxType string, payload []byte) error) error {
+	for pos := 0; pos < len(data); {
+		remaining := uint64(len(data) - pos)
+
+		if remaining < 8 {
+			return errMalformedAvif
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data[pos:]))
+		boxType := string(data[pos+4 : pos+8])
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			// the box extends to the end of the file
+			size = remaining
+		case 1:
+			if remaining < 16 {
+				return errMalformedAvif
+			}
+
+			size = binary.BigEndian.Uint64(data[pos+8:])
+			header = 16
+		}
+
+		if size < header || size > remaining {
+			return errMalformedAvif
+		}
+
+		if err := visit(boxType, data[pos+int(header):pos+int(size)]); err != nil {
+			return err
+		}
+
+		pos += int(size)
+	}
+
+	return nil
+}
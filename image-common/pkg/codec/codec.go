@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+	"strings"
+)
+
+type Codec interface {
+	Format() Format
+	Decode(r io.Reader) (image.Image, error)
+	Encode(w io.Writer, img image.Image, options EncodeOptions) error
+}
+
+type Registry struct {
+	codecs map[string]Codec
+}
+
+func NewRegistry(codecs ...Codec) *Registry {
+	registry := &Registry{
+		codecs: make(map[string]Codec),
+	}
+
+	for _, codec := range codecs {
+		registry.Register(codec)
+	}
+
+	return registry
+}
+
+func (r *Registry) Register(codec Codec) {
+	for _, ext := range codec.Format().Extensions {
+		r.codecs[strings.ToLower(ext)] = codec
+	}
+}
+
+func (r *Registry) Lookup(ext string) (Codec, bool) {
+	codec, prs := r.codecs[strings.ToLower(ext)]
+	return codec, prs
+}
+
+func (r *Registry) Decoder(ext string) (Codec, error) {
+	codec, prs := r.Lookup(ext)
+
+	if !prs || !codec.Format().Capabilities.Decode {
+		return nil, errors.New(fmt.Sprintf("Decoding of %s format is not supported", ext))
+	}
+
+	return codec, nil
+}
+
+func (r *Registry) Encoder(ext string) (Codec, error) {
+	codec, prs := r.Lookup(ext)
+
+	if !prs || !codec.Format().Capabilities.Encode {
+		return nil, errors.New(fmt.Sprintf("Encoding to %s format is not supported", ext))
+	}
+
+	return codec, nil
+}
+
+func (r *Registry) Extensions() []string {
+	extensions := make([]string, 0, len(r.codecs))
+
+	for ext := range r.codecs {
+		extensions = append(extensions, ext)
+	}
+
+	sort.Strings(extensions)
+
+	return extensions
+}
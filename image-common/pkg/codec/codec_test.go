@@ -0,0 +1,54 @@
+package codec_test
+
+import (
+	"image-common/pkg/codec"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := codec.NewRegistry(codec.NewJpegCodec(), codec.NewPngCodec(), codec.NewBmpCodec())
+
+	tests := []struct {
+		ext     string
+		format  string
+		decoder bool
+		encoder bool
+	}{
+		{"jpg", "jpeg", true, true},
+		{"JPEG", "jpeg", true, true},
+		{"png", "png", true, true},
+		{"bmp", "bmp", true, false},
+		{"webp", "", false, false},
+		{"", "", false, false},
+	}
+
+	for _, test := range tests {
+		c, prs := registry.Lookup(test.ext)
+
+		if prs != (test.format != "") || (prs && c.Format().Name != test.format) {
+			t.Errorf("%q: expected the %q codec, got %v", test.ext, test.format, c)
+		}
+
+		if _, err := registry.Decoder(test.ext); (err == nil) != test.decoder {
+			t.Errorf("%q: expected a decoder %v, got %v", test.ext, test.decoder, err)
+		}
+
+		if _, err := registry.Encoder(test.ext); (err == nil) != test.encoder {
+			t.Errorf("%q: expected an encoder %v, got %v", test.ext, test.encoder, err)
+		}
+	}
+
+	if extensions := registry.Extensions(); !reflect.DeepEqual(extensions, []string{"bmp", "jpeg", "jpg", "png"}) {
+		t.Errorf("expected the extensions of every codec, got %v", extensions)
+	}
+}
+
+func TestRegistryReplacesCodec(t *testing.T) {
+	registry := codec.NewRegistry(codec.NewBmpCodec())
+	registry.Register(codec.NewPngCodec())
+
+	if c, _ := registry.Lookup("png"); c.Format().Name != "png" {
+		t.Errorf("expected the registered codec, got %s", c.Format().Name)
+	}
+}
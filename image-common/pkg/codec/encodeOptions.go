@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	CompressionDefault = "default"
+	CompressionNone    = "none"
+	CompressionFast    = "fast"
+	CompressionBest    = "best"
+)
+
+// EncodeOptions fields are optional so that options set per upload request
+// can be layered over the globally configured ones with Merge.
+type EncodeOptions struct {
+	Quality          *float32 `json:"quality,omitempty"`
+	Lossless         *bool    `json:"lossless,omitempty"`
+	Progressive      *bool    `json:"progressive,omitempty"`
+	CompressionLevel *string  `json:"compressionLevel,omitempty"`
+	Speed            *int     `json:"speed,omitempty"`
+}
+
+func (o EncodeOptions) Merge(override EncodeOptions) EncodeOptions {
+	if override.Quality != nil {
+		o.Quality = override.Quality
+	}
+
+	if override.Lossless != nil {
+		o.Lossless = override.Lossless
+	}
+
+	if override.Progressive != nil {
+		o.Progressive = override.Progressive
+	}
+
+	if override.CompressionLevel != nil {
+		o.CompressionLevel = override.CompressionLevel
+	}
+
+	if override.Speed != nil {
+		o.Speed = override.Speed
+	}
+
+	return o
+}
+
+func (o EncodeOptions) Validate() error {
+	if o.Quality != nil && (*o.Quality < 1 || *o.Quality > 100) {
+		return errors.New(fmt.Sprintf("Quality must be between 1 and 100, got %v", *o.Quality))
+	}
+
+	if o.Speed != nil && (*o.Speed < 0 || *o.Speed > 10) {
+		return errors.New(fmt.Sprintf("Speed must be between 0 and 10, got %d", *o.Speed))
+	}
+
+	if o.CompressionLevel != nil {
+		switch *o.CompressionLevel {
+		case CompressionDefault, CompressionNone, CompressionFast, CompressionBest:
+		default:
+			return errors.New(fmt.Sprintf("Unknown compression level %s", *o.CompressionLevel))
+		}
+	}
+
+	return nil
+}
+
+func (o EncodeOptions) QualityOr(defaultValue float32) float32 {
+	if o.Quality == nil {
+		return defaultValue
+	}
+
+	return *o.Quality
+}
+
+func (o EncodeOptions) IsLossless() bool {
+	return o.Lossless != nil && *o.Lossless
+}
+
+func (o EncodeOptions) IsProgressive() bool {
+	return o.Progressive != nil && *o.Progressive
+}
+
+func (o EncodeOptions) CompressionLevelOr(defaultValue string) string {
+	if o.CompressionLevel == nil {
+		return defaultValue
+	}
+
+	return *o.CompressionLevel
+}
+
+func (o EncodeOptions) SpeedOr(defaultValue int) int {
+	if o.Speed == nil {
+		return defaultValue
+	}
+
+	return *o.Speed
+}
+
+// OptionsForFormat picks the options addressed to the given format, accepting
+// both the format name and any of its extensions as a key.
+func OptionsForFormat(options map[string]EncodeOptions, format string) EncodeOptions {
+	result := EncodeOptions{}
+
+	if f, prs := FormatByExtension(format); prs && f.Name != format {
+		result = result.Merge(options[f.Name])
+	}
+
+	return result.Merge(options[format])
+}
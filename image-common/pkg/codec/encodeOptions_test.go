@@ -0,0 +1,110 @@
+package codec_test
+
+import (
+	"image-common/pkg/codec"
+	"reflect"
+	"testing"
+)
+
+func float32Ptr(v float32) *float32 {
+	return &v
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestOptionsForFormat(t *testing.T) {
+	options := map[string]codec.EncodeOptions{
+		"jpeg": {Quality: float32Ptr(80), Progressive: boolPtr(true)},
+		"jpg":  {Quality: float32Ptr(90)},
+		"tif":  {CompressionLevel: stringPtr(codec.CompressionBest)},
+		"webp": {Lossless: boolPtr(true)},
+	}
+
+	tests := []struct {
+		format   string
+		expected codec.EncodeOptions
+	}{
+		// the options of an extension win over the ones of its format
+		{"jpg", codec.EncodeOptions{Quality: float32Ptr(90), Progressive: boolPtr(true)}},
+		{"jpeg", codec.EncodeOptions{Quality: float32Ptr(80), Progressive: boolPtr(true)}},
+		{"tiff", codec.EncodeOptions{}},
+		{"tif", codec.EncodeOptions{CompressionLevel: stringPtr(codec.CompressionBest)}},
+		{"webp", codec.EncodeOptions{Lossless: boolPtr(true)}},
+		{"png", codec.EncodeOptions{}},
+	}
+
+	for _, test := range tests {
+		if actual := codec.OptionsForFormat(options, test.format); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.format, test.expected, actual)
+		}
+	}
+}
+
+func TestMergeEncodeOptions(t *testing.T) {
+	configured := codec.EncodeOptions{
+		Quality:          float32Ptr(75),
+		Lossless:         boolPtr(true),
+		CompressionLevel: stringPtr(codec.CompressionFast),
+	}
+
+	tests := []struct {
+		name     string
+		override codec.EncodeOptions
+		expected codec.EncodeOptions
+	}{
+		{"Empty", codec.EncodeOptions{}, configured},
+		{
+			"Quality",
+			codec.EncodeOptions{Quality: float32Ptr(50)},
+			codec.EncodeOptions{Quality: float32Ptr(50), Lossless: boolPtr(true), CompressionLevel: stringPtr(codec.CompressionFast)},
+		},
+		{
+			// a false override is set, not missing
+			"Lossless",
+			codec.EncodeOptions{Lossless: boolPtr(false), Speed: intPtr(4)},
+			codec.EncodeOptions{Quality: float32Ptr(75), Lossless: boolPtr(false), CompressionLevel: stringPtr(codec.CompressionFast), Speed: intPtr(4)},
+		},
+	}
+
+	for _, test := range tests {
+		if actual := configured.Merge(test.override); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, actual)
+		}
+	}
+
+	if !configured.IsLossless() || *configured.Quality != 75 {
+		t.Error("expected Merge to leave the configured options as they are")
+	}
+}
+
+func TestValidateEncodeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options codec.EncodeOptions
+		valid   bool
+	}{
+		{"Empty", codec.EncodeOptions{}, true},
+		{"Quality", codec.EncodeOptions{Quality: float32Ptr(100), Speed: intPtr(0)}, true},
+		{"QualityTooLow", codec.EncodeOptions{Quality: float32Ptr(0)}, false},
+		{"QualityTooHigh", codec.EncodeOptions{Quality: float32Ptr(101)}, false},
+		{"SpeedTooHigh", codec.EncodeOptions{Speed: intPtr(11)}, false},
+		{"CompressionLevel", codec.EncodeOptions{CompressionLevel: stringPtr(codec.CompressionNone)}, true},
+		{"UnknownCompressionLevel", codec.EncodeOptions{CompressionLevel: stringPtr("max")}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.options.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
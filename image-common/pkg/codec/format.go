@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+type Capabilities struct {
+	Decode    bool
+	Encode    bool
+	Lossless  bool
+	Animation bool
+}
+
+type Format struct {
+	Name         string
+	Extensions   []string
+	MimeType     string
+	Capabilities Capabilities
+}
+
+var (
+	Jpeg = Format{
+		Name:         "jpeg",
+		Extensions:   []string{"jpeg", "jpg"},
+		MimeType:     "image/jpeg",
+		Capabilities: Capabilities{Decode: true, Encode: true},
+	}
+	Png = Format{
+		Name:         "png",
+		Extensions:   []string{"png"},
+		MimeType:     "image/png",
+		Capabilities: Capabilities{Decode: true, Encode: true, Lossless: true},
+	}
+	Webp = Format{
+		Name:         "webp",
+		Extensions:   []string{"webp"},
+		MimeType:     "image/webp",
+		Capabilities: Capabilities{Decode: true, Encode: true, Lossless: true, Animation: true},
+	}
+	Avif = Format{
+		Name:         "avif",
+		Extensions:   []string{"avif"},
+		MimeType:     "image/avif",
+		Capabilities: Capabilities{Decode: true, Encode: true},
+	}
+	Gif = Format{
+		Name:         "gif",
+		Extensions:   []string{"gif"},
+		MimeType:     "image/gif",
+		Capabilities: Capabilities{Decode: true, Encode: true, Lossless: true, Animation: true},
+	}
+	Bmp = Format{
+		Name:         "bmp",
+		Extensions:   []string{"bmp"},
+		MimeType:     "image/bmp",
+		Capabilities: Capabilities{Decode: true, Lossless: true},
+	}
+	Tiff = Format{
+		Name:         "tiff",
+		Extensions:   []string{"tiff", "tif"},
+		MimeType:     "image/tiff",
+		Capabilities: Capabilities{Decode: true, Lossless: true},
+	}
+)
+
+// Formats is the definition of every format the pipeline knows about,
+// shared by image-service validation and image-saver conversion.
+var Formats = []Format{Jpeg, Png, Webp, Avif, Gif, Bmp, Tiff}
+
+func FormatByExtension(ext string) (Format, bool) {
+	ext = strings.ToLower(ext)
+
+	for _, format := range Formats {
+		for _, formatExt := range format.Extensions {
+			if formatExt == ext {
+				return format, true
+			}
+		}
+	}
+
+	return Format{}, false
+}
+
+func Extension(fileName string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+}
@@ -0,0 +1,147 @@
+package codec
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+)
+
+type gifCodec struct{}
+
+func NewGifCodec() AnimatedCodec {
+	return &gifCodec{}
+}
+
+func (c *gifCodec) Format() Format {
+	return Gif
+}
+
+// Decode returns the first frame of animations, gif.Decode stops reading
+// there. The frame is drawn on the canvas when it only covers part of it.
+func (c *gifCodec) Decode(r io.Reader) (image.Image, error) {
+	file, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := gif.DecodeConfig(bytes.NewReader(file))
+
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := gif.Decode(bytes.NewReader(file))
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, config.Width, config.Height)
+
+	if frame.Bounds() == bounds {
+		return frame, nil
+	}
+
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+
+	return canvas, nil
+}
+
+func (c *gifCodec) Encode(w io.Writer, img image.Image, options EncodeOptions) error {
+	return gif.Encode(w, img, nil)
+}
+
+func (c *gifCodec) DecodeAll(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	animation := &Animation{
+		Frames:    make([]image.Image, 0, len(g.Image)),
+		Delays:    make([]time.Duration, 0, len(g.Image)),
+		LoopCount: gifToLoopCount(g.LoopCount),
+	}
+
+	// gif frames are patches over the previous canvas, compose them into full frames
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		disposal := byte(gif.DisposalNone)
+
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		composed := image.NewRGBA(bounds)
+		draw.Draw(composed, bounds, canvas, bounds.Min, draw.Src)
+
+		animation.Frames = append(animation.Frames, composed)
+		animation.Delays = append(animation.Delays, time.Duration(g.Delay[i])*10*time.Millisecond)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return animation, nil
+}
+
+func (c *gifCodec) EncodeAll(w io.Writer, animation *Animation, options EncodeOptions) error {
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(animation.Frames)),
+		Delay:     make([]int, 0, len(animation.Frames)),
+		LoopCount: loopCountToGif(animation.LoopCount),
+	}
+
+	for i, frame := range animation.Frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, frame.Bounds(), frame, frame.Bounds().Min)
+
+		g.Image = append(g.Image, paletted)
+		g.Delay = append(g.Delay, int(animation.Delays[i]/(10*time.Millisecond)))
+	}
+
+	return gif.EncodeAll(w, g)
+}
+
+// gif counts repeats after the first play and uses -1 for a single play
+func gifToLoopCount(gifLoopCount int) int {
+	switch {
+	case gifLoopCount < 0:
+		return 1
+	case gifLoopCount == 0:
+		return 0
+	default:
+		return gifLoopCount + 1
+	}
+}
+
+func loopCountToGif(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount == 1:
+		return -1
+	default:
+		return loopCount - 1
+	}
+}
@@ -0,0 +1,72 @@
+package codec_test
+
+import (
+	"bytes"
+	"image"
+	"image-common/pkg/codec"
+	"image/color"
+	"image/gif"
+	"testing"
+	"time"
+)
+
+func newTestAnimation(frames int, loopCount int) *codec.Animation {
+	animation := &codec.Animation{LoopCount: loopCount}
+
+	for i := 0; i < frames; i++ {
+		frame := image.NewRGBA(image.Rect(0, 0, 4, 4))
+		frame.Set(i%4, 0, color.White)
+
+		animation.Frames = append(animation.Frames, frame)
+		animation.Delays = append(animation.Delays, 100*time.Millisecond)
+	}
+
+	return animation
+}
+
+func TestGifLoopCount(t *testing.T) {
+	tests := []struct {
+		name         string
+		loopCount    int
+		gifLoopCount int
+	}{
+		{"Forever", 0, 0},
+		{"Once", 1, -1},
+		{"Twice", 2, 1},
+		{"TenTimes", 10, 9},
+	}
+
+	gifCodec := codec.NewGifCodec()
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+
+		if err := gifCodec.EncodeAll(&buf, newTestAnimation(2, test.loopCount), codec.EncodeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := gif.DecodeAll(bytes.NewReader(buf.Bytes()))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g.LoopCount != test.gifLoopCount {
+			t.Errorf("%s: expected the gif loop count %d, got %d", test.name, test.gifLoopCount, g.LoopCount)
+		}
+
+		animation, err := gifCodec.DecodeAll(bytes.NewReader(buf.Bytes()))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if animation.LoopCount != test.loopCount {
+			t.Errorf("%s: expected the loop count %d back, got %d", test.name, test.loopCount, animation.LoopCount)
+		}
+
+		if len(animation.Frames) != 2 || animation.Duration() != 200*time.Millisecond {
+			t.Errorf("%s: expected 2 frames of 100ms, got %d frames of %s", test.name, len(animation.Frames), animation.Duration())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// PixelLimits bound the images that are decoded, 0 disables a limit.
+type PixelLimits struct {
+	MaxWidth      int
+	MaxHeight     int
+	MaxMegapixels float64
+}
+
+// ErrUnknownSize is returned by Check for files whose dimensions can't be
+// read, they are refused rather than decoded without a bound.
+var ErrUnknownSize = errors.New("The dimensions of the image can't be read")
+
+type PixelLimitError struct {
+	Width  int
+	Height int
+	Limits PixelLimits
+}
+
+func (e *PixelLimitError) Error() string {
+	return fmt.Sprintf(
+		"Image of %dx%d pixels exceeds the limits of %dx%d pixels and %g megapixels",
+		e.Width,
+		e.Height,
+		e.Limits.MaxWidth,
+		e.Limits.MaxHeight,
+		e.Limits.MaxMegapixels,
+	)
+}
+
+// Check reads the dimensions from the header of file, so that an image
+// declaring a huge size is rejected before it is decoded. Files of unknown
+// dimensions are refused unless every limit is disabled.
+func (l PixelLimits) Check(file []byte) error {
+	if l == (PixelLimits{}) {
+		return nil
+	}
+
+	width, height, err := DecodeSize(file)
+
+	if err != nil {
+		return err
+	}
+
+	return l.CheckSize(width, height)
+}
+
+// DecodeSize reads the dimensions of an image of any decoded format without
+// decoding it. Animations report the size of their canvas.
+func DecodeSize(file []byte) (width int, height int, err error) {
+	if isAvif(file) {
+		return avifSize(file)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(file))
+
+	if errors.Is(err, image.ErrFormat) {
+		return 0, 0, ErrUnknownSize
+	}
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return config.Width, config.Height, nil
+}
+
+func (l PixelLimits) CheckSize(width int, height int) error {
+	exceeds := (l.MaxWidth > 0 && width > l.MaxWidth) ||
+		(l.MaxHeight > 0 && height > l.MaxHeight) ||
+		(l.MaxMegapixels > 0 && float64(width)*float64(height) > l.MaxMegapixels*1e6)
+
+	if exceeds {
+		return &PixelLimitError{width, height, l}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image-common/pkg/codec"
+	"image/png"
+	"testing"
+)
+
+func encodeTestPng(t *testing.T, width int, height int) []byte {
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func newTestBox(boxType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+
+	return append(append(box, boxType...), data...)
+}
+
+// newTestAvif builds the boxes of an avif file holding the sizes of its
+// items, the image data is left out since only the headers are read.
+func newTestAvif(brand string, sizes ...[2]uint32) []byte {
+	properties := make([][]byte, 0, len(sizes))
+
+	for _, size := range sizes {
+		ispe := make([]byte, 12)
+		binary.BigEndian.PutUint32(ispe[4:], size[0])
+		binary.BigEndian.PutUint32(ispe[8:], size[1])
+		properties = append(properties, newTestBox("ispe", ispe))
+	}
+
+	return append(
+		newTestBox("ftyp", []byte(brand), make([]byte, 4), []byte("mif1avif")),
+		newTestBox("meta", make([]byte, 4), newTestBox("iprp", newTestBox("ipco", properties...)))...,
+	)
+}
+
+// newTestAvifSequence holds the size in the track header only.
+func newTestAvifSequence(width uint32, height uint32) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], width<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], height<<16)
+
+	return append(
+		newTestBox("ftyp", []byte("avis"), make([]byte, 4), []byte("msf1")),
+		newTestBox("moov", newTestBox("trak", newTestBox("tkhd", tkhd)))...,
+	)
+}
+
+func TestPixelLimitsCheck(t *testing.T) {
+	limits := codec.PixelLimits{MaxWidth: 1000, MaxHeight: 1000, MaxMegapixels: 0.5}
+
+	oversizedGif := newTestAnimation(3, 0)
+	oversizedGif.Frames[0] = image.NewRGBA(image.Rect(0, 0, 1200, 4))
+
+	tests := []struct {
+		name     string
+		file     []byte
+		expected error
+	}{
+		{"Png", encodeTestPng(t, 600, 600), nil},
+		{"PngTooWide", encodeTestPng(t, 1001, 1), &codec.PixelLimitError{}},
+		{"PngTooManyPixels", encodeTestPng(t, 800, 800), &codec.PixelLimitError{}},
+		{"AnimatedGif", encodeTestGif(t, newTestAnimation(3, 0)), nil},
+		{"AnimatedGifTooWide", encodeTestGif(t, oversizedGif), &codec.PixelLimitError{}},
+		{"AnimatedWebp", newTestWebp(600, 600, 100, 100), nil},
+		{"AnimatedWebpTooTall", newTestWebp(10, 1001, 100), &codec.PixelLimitError{}},
+		{"Avif", newTestAvif("avif", [2]uint32{600, 600}), nil},
+		{"AvifTooManyPixels", newTestAvif("avif", [2]uint32{50000, 50000}), &codec.PixelLimitError{}},
+		// by its compatible brand, the primary item comes after its thumbnail
+		{"AvifLargestItem", newTestAvif("mif1", [2]uint32{100, 100}, [2]uint32{2000, 2000}), &codec.PixelLimitError{}},
+		{"AvifSequence", newTestAvifSequence(600, 600), nil},
+		{"AvifSequenceTooWide", newTestAvifSequence(4000, 10), &codec.PixelLimitError{}},
+		{"AvifWithoutSize", newTestAvif("avif"), codec.ErrUnknownSize},
+		{"AvifTruncated", newTestAvif("avif", [2]uint32{600, 600})[:40], errors.New("")},
+		{"UnknownFormat", []byte("not an image at all"), codec.ErrUnknownSize},
+	}
+
+	for _, test := range tests {
+		err := limits.Check(test.file)
+
+		var pixelLimitErr *codec.PixelLimitError
+
+		switch expected := test.expected.(type) {
+		case nil:
+			if err != nil {
+				t.Errorf("%s: expected no error, got %s", test.name, err)
+			}
+		case *codec.PixelLimitError:
+			if !errors.As(err, &pixelLimitErr) {
+				t.Errorf("%s: expected a pixel limit error, got %v", test.name, err)
+			}
+		default:
+			if err == nil || (expected == codec.ErrUnknownSize && !errors.Is(err, expected)) {
+				t.Errorf("%s: expected %v, got %v", test.name, expected, err)
+			}
+		}
+	}
+}
+
+func TestPixelLimitsDisabled(t *testing.T) {
+	if err := (codec.PixelLimits{}).Check([]byte("not an image at all")); err != nil {
+		t.Errorf("expected no check without limits, got %s", err)
+	}
+}
@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+type jpegCodec struct{}
+
+func NewJpegCodec() Codec {
+	return &jpegCodec{}
+}
+
+func (c *jpegCodec) Format() Format {
+	return Jpeg
+}
+
+func (c *jpegCodec) Decode(r io.Reader) (image.Image, error) {
+	return jpeg.Decode(r)
+}
+
+func (c *jpegCodec) Encode(w io.Writer, img image.Image, options EncodeOptions) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: int(options.QualityOr(jpeg.DefaultQuality))})
+}
+
+var pngCompressionLevels map[string]png.CompressionLevel = map[string]png.CompressionLevel{
+	CompressionDefault: png.DefaultCompression,
+	CompressionNone:    png.NoCompression,
+	CompressionFast:    png.BestSpeed,
+	CompressionBest:    png.BestCompression,
+}
+
+type pngCodec struct{}
+
+func NewPngCodec() Codec {
+	return &pngCodec{}
+}
+
+func (c *pngCodec) Format() Format {
+	return Png
+}
+
+func (c *pngCodec) Decode(r io.Reader) (image.Image, error) {
+	return png.Decode(r)
+}
+
+func (c *pngCodec) Encode(w io.Writer, img image.Image, options EncodeOptions) error {
+	encoder := png.Encoder{
+		CompressionLevel: pngCompressionLevels[options.CompressionLevelOr(CompressionDefault)],
+	}
+
+	return encoder.Encode(w, img)
+}
+
+// decodeOnlyCodec serves formats accepted as uploads but never produced
+// as variants.
+type decodeOnlyCodec struct {
+	format Format
+	decode func(r io.Reader) (image.Image, error)
+}
+
+func NewBmpCodec() Codec {
+	return &decodeOnlyCodec{Bmp, bmp.Decode}
+}
+
+func NewTiffCodec() Codec {
+	return &decodeOnlyCodec{Tiff, tiff.Decode}
+}
+
+func (c *decodeOnlyCodec) Format() Format {
+	return c.format
+}
+
+func (c *decodeOnlyCodec) Decode(r io.Reader) (image.Image, error) {
+	return c.decode(r)
+}
+
+func (c *decodeOnlyCodec) Encode(w io.Writer, img image.Image, options EncodeOptions) error {
+	return errors.New("Encoding to " + c.format.Name + " format is not supported")
+}
@@ -0,0 +1,206 @@
+package contracts
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-common/pkg/codec"
+	"image-common/pkg/imaging"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Versions change only for incompatible changes. Optional fields can be
+// added within a version since consumers ignore unknown fields, which lets
+// either service be deployed first.
+const (
+	ConversionJobVersion    = 1
+	ConversionResultVersion = 1
+)
+
+const (
+	ResultCompleted = "completed"
+	ResultFailed    = "failed"
+)
+
+// Jobs without a priority are interactive.
+const (
+	PriorityInteractive = "interactive"
+	PriorityBulk        = "bulk"
+)
+
+// ConversionJob is published by image service for image-saver. Jobs with
+// KeepOriginal leave the original in place once converted, image service
+// crops it again when the focal point of the image moves.
+type ConversionJob struct {
+	Version           int                            `json:"version"`
+	JobId             string                         `json:"jobId,omitempty"`
+	OriginalImageName string                         `json:"originalImageName"`
+	SaveName          string                         `json:"saveName"`
+	SaveFormats       []string                       `json:"saveFormats"`
+	EncodeOptions     map[string]codec.EncodeOptions `json:"encodeOptions,omitempty"`
+	Animation         string                         `json:"animation,omitempty"`
+	MaxWidth          int                            `json:"maxWidth,omitempty"`
+	MaxHeight         int                            `json:"maxHeight,omitempty"`
+	CropAspectRatio   string                         `json:"cropAspectRatio,omitempty"`
+	FocalPoint        *imaging.FocalPoint            `json:"focalPoint,omitempty"`
+	Priority          string                         `json:"priority,omitempty"`
+	ImageCreatedDate  *time.Time                     `json:"imageCreatedDate,omitempty"`
+	KeepOriginal      bool                           `json:"keepOriginal,omitempty"`
+}
+
+type ConversionResult struct {
+	Version  int      `json:"version"`
+	JobId    string   `json:"jobId"`
+	SaveName string   `json:"saveName"`
+	Status   string   `json:"status"`
+	Formats  []string `json:"formats,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ResultQueueName is where image-saver reports on the jobs of queueName.
+func ResultQueueName(queueName string) string {
+	return queueName + ".results"
+}
+
+// LaneQueueName is the queue jobs of priority are published to, interactive
+// jobs use queueName itself so that jobs of older publishers keep flowing.
+func LaneQueueName(queueName string, priority string) string {
+	if priority == PriorityBulk {
+		return queueName + ".bulk"
+	}
+
+	return queueName
+}
+
+// VersionError is returned for messages newer than this build understands.
+// It isn't permanent: during a rollout an upgraded consumer can take them.
+type VersionError struct {
+	Message string
+	Version int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("Unsupported %s version %d", e.Message, e.Version)
+}
+
+// ValidationError means the message doesn't match its schema and never will.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+var (
+	conversionJobSchemas    = compileSchemas("conversionJob", ConversionJobVersion)
+	conversionResultSchemas = compileSchemas("conversionResult", ConversionResultVersion)
+)
+
+// DecodeConversionJob validates the job against the schema of its version.
+// Jobs published before messages were versioned have no version and are
+// read as version 1, which they match.
+func DecodeConversionJob(body []byte) (*ConversionJob, error) {
+	var job ConversionJob
+
+	err := decode(body, "conversion job", conversionJobSchemas, &job)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Version == 0 {
+		job.Version = 1
+	}
+
+	return &job, nil
+}
+
+func DecodeConversionResult(body []byte) (*ConversionResult, error) {
+	var result ConversionResult
+
+	err := decode(body, "conversion result", conversionResultSchemas, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func decode(body []byte, message string, schemas map[int]*jsonschema.Schema, v interface{}) error {
+	var document interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&document); err != nil {
+		return &ValidationError{err}
+	}
+
+	version := 1
+
+	if fields, ok := document.(map[string]interface{}); ok {
+		if value, prs := fields["version"]; prs {
+			number, ok := value.(json.Number)
+			parsed, err := number.Int64()
+
+			if !ok || err != nil {
+				return &ValidationError{errors.New(fmt.Sprintf("Invalid %s version %v", message, value))}
+			}
+
+			version = int(parsed)
+		}
+	}
+
+	schema, prs := schemas[version]
+
+	if !prs {
+		return &VersionError{message, version}
+	}
+
+	if err := schema.Validate(document); err != nil {
+		return &ValidationError{err}
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return &ValidationError{err}
+	}
+
+	return nil
+}
+
+func compileSchemas(name string, latestVersion int) map[int]*jsonschema.Schema {
+	schemas := make(map[int]*jsonschema.Schema)
+
+	for version := 1; version <= latestVersion; version++ {
+		fileName := fmt.Sprintf("%s.v%d.json", name, version)
+		file, err := schemaFiles.ReadFile("schemas/" + fileName)
+
+		if err != nil {
+			panic(err)
+		}
+
+		url := "https://image-common/schemas/" + fileName
+		compiler := jsonschema.NewCompiler()
+
+		if err := compiler.AddResource(url, bytes.NewReader(file)); err != nil {
+			panic(err)
+		}
+
+		schemas[version] = compiler.MustCompile(url)
+	}
+
+	return schemas
+}
@@ -0,0 +1,115 @@
+package contracts_test
+
+import (
+	"encoding/json"
+	"errors"
+	"image-common/pkg/contracts"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeConversionJob(t *testing.T) {
+	job := contracts.ConversionJob{
+		Version:           contracts.ConversionJobVersion,
+		JobId:             "b5f7c1c8-7a37-4a5e-9f1b-0d8e3f1d2c4a",
+		OriginalImageName: "id-original.png",
+		SaveName:          "id",
+		SaveFormats:       []string{"webp", "avif"},
+		CropAspectRatio:   "16:9",
+		Priority:          contracts.PriorityBulk,
+		KeepOriginal:      true,
+	}
+
+	body, err := json.Marshal(job)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := contracts.DecodeConversionJob(body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*decoded, job) {
+		t.Errorf("expected %+v, got %+v", job, *decoded)
+	}
+
+	// published before the messages were versioned
+	decoded, err = contracts.DecodeConversionJob([]byte(`{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "unknown": 1}`))
+
+	if err != nil || decoded.Version != 1 {
+		t.Errorf("expected an unversioned job to be read as version 1, got %+v, %v", decoded, err)
+	}
+}
+
+func TestDecodeConversionJobRejectsInvalidJobs(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"NotJson", `{"originalImageName": `},
+		{"NotAnObject", `["a.png"]`},
+		{"MissingOriginal", `{"saveName": "a", "saveFormats": ["png"]}`},
+		{"EmptySaveName", `{"originalImageName": "a.png", "saveName": "", "saveFormats": ["png"]}`},
+		{"SaveFormatsNotArray", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": "png"}`},
+		{"EmptyFormat", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": [""]}`},
+		{"QualityTooHigh", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "encodeOptions": {"webp": {"quality": 101}}}`},
+		{"UnknownCompression", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "encodeOptions": {"png": {"compressionLevel": "max"}}}`},
+		{"InvalidAspectRatio", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "cropAspectRatio": "16/9"}`},
+		{"FocalPointOutside", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "focalPoint": {"x": 1.5, "y": 0}}`},
+		{"FocalPointWithoutY", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "focalPoint": {"x": 0.5}}`},
+		{"UnknownPriority", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "priority": "urgent"}`},
+		{"NegativeWidth", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "maxWidth": -1}`},
+		{"KeepOriginalNotBoolean", `{"originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"], "keepOriginal": "yes"}`},
+		{"VersionNotNumber", `{"version": "1", "originalImageName": "a.png", "saveName": "a", "saveFormats": ["png"]}`},
+	}
+
+	for _, test := range tests {
+		_, err := contracts.DecodeConversionJob([]byte(test.body))
+
+		var validationErr *contracts.ValidationError
+
+		if !errors.As(err, &validationErr) {
+			t.Errorf("%s: expected a validation error, got %v", test.name, err)
+		}
+	}
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	_, err := contracts.DecodeConversionJob([]byte(`{"version": 2, "originalImageName": "a.png"}`))
+
+	var versionErr *contracts.VersionError
+
+	if !errors.As(err, &versionErr) || versionErr.Version != 2 {
+		t.Errorf("expected a version error, got %v", err)
+	}
+
+	_, err = contracts.DecodeConversionResult([]byte(`{"version": 3, "jobId": "a"}`))
+
+	if !errors.As(err, &versionErr) || versionErr.Version != 3 {
+		t.Errorf("expected a version error, got %v", err)
+	}
+}
+
+func TestDecodeConversionResult(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"Completed", `{"version": 1, "jobId": "a", "saveName": "a", "status": "completed", "formats": ["webp"]}`, true},
+		{"Failed", `{"version": 1, "jobId": "a", "saveName": "a", "status": "failed", "error": "webp: encoder failed"}`, true},
+		{"UnknownStatus", `{"version": 1, "jobId": "a", "saveName": "a", "status": "done"}`, false},
+		{"MissingJobId", `{"version": 1, "saveName": "a", "status": "completed"}`, false},
+	}
+
+	for _, test := range tests {
+		_, err := contracts.DecodeConversionResult([]byte(test.body))
+
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownKey is wrapped by the errors of Decrypt for files encrypted with
+// a key-encryption key that is not in the keyring.
+var ErrUnknownKey = errors.New("unknown key-encryption key")
+
+// ErrCorrupted is wrapped by the errors of Decrypt for files that fail
+// authentication, decrypting them again won't help.
+var ErrCorrupted = errors.New("corrupted encrypted file")
+
+// An encrypted file is the header, the nonce and the ciphertext of the file.
+// The header holds the id of the key-encryption key and the data key
+// encrypted with it. Both the data key and the ciphertext are authenticated
+// with the key of the object they are stored under, and the ciphertext with
+// the header too, so a file can't be passed for another one.
+var magic = []byte("IENC")
+
+const version = 2
+
+const keySize = 32
+
+// Keyring encrypts every file with a data key of its own, wrapped with the
+// current key-encryption key. The other keys only decrypt the files written
+// before a rotation.
+type Keyring struct {
+	currentId string
+	keys      map[string]cipher.AEAD
+}
+
+func NewKeyring(currentId string, keys map[string][]byte) (*Keyring, error) {
+	keyring := &Keyring{
+		currentId: currentId,
+		keys:      make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, errors.New(fmt.Sprintf("Invalid key id %q", id))
+		}
+
+		if len(key) != keySize {
+			return nil, errors.New(fmt.Sprintf("The key %s must be %d bytes long, got %d", id, keySize, len(key)))
+		}
+
+		aead, err := newAead(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keyring.keys[id] = aead
+	}
+
+	if _, prs := keyring.keys[currentId]; !prs {
+		return nil, errors.New(fmt.Sprintf("The current key %q is not in the keyring", currentId))
+	}
+
+	return keyring, nil
+}
+
+func (k *Keyring) CurrentId() string {
+	return k.currentId
+}
+
+// IsEncrypted tells the files written by Encrypt from the others, which
+// were stored before the encryption was enabled.
+func IsEncrypted(data []byte) bool {
+	return hasMagic(data) && data[len(magic)] == version
+}
+
+func hasMagic(data []byte) bool {
+	return len(data) > len(magic) && bytes.Equal(data[:len(magic)], magic)
+}
+
+// Encrypt encrypts the file stored under objectKey, which only decrypts
+// under the same key.
+func (k *Keyring) Encrypt(objectKey string, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, keySize)
+
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := seal(k.keys[k.currentId], dataKey, wrapAdditionalData(k.currentId, objectKey))
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAead(dataKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fileHeader := header(k.currentId, wrappedKey)
+	ciphertext, err := seal(aead, plaintext, contentAdditionalData(fileHeader, objectKey))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(fileHeader, ciphertext...), nil
+}
+
+// Decrypt returns the files stored before the encryption was enabled as
+// they are. An encrypted file of another version is refused rather than
+// passed for a clear one.
+func (k *Keyring) Decrypt(objectKey string, data []byte) ([]byte, error) {
+	if hasMagic(data) && !IsEncrypted(data) {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrCorrupted, data[len(magic)])
+	}
+
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	parsed, err := parseHeader(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := k.unwrap(parsed.keyId, parsed.wrappedKey, wrapAdditionalData(parsed.keyId, objectKey))
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAead(dataKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, parsed.ciphertext, contentAdditionalData(parsed.header, objectKey))
+}
+
+// Rewrap encrypts the file again under the current key-encryption key, the
+// header being authenticated with the content. It returns false with the
+// file as it is for files already under the current key and files that are
+// not encrypted.
+func (k *Keyring) Rewrap(objectKey string, data []byte) ([]byte, bool, error) {
+	if !IsEncrypted(data) {
+		return data, false, nil
+	}
+
+	parsed, err := parseHeader(data)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if parsed.keyId == k.currentId {
+		return data, false, nil
+	}
+
+	plaintext, err := k.Decrypt(objectKey, data)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	encrypted, err := k.Encrypt(objectKey, plaintext)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return encrypted, true, nil
+}
+
+func (k *Keyring) unwrap(keyId string, wrappedKey []byte, additionalData []byte) ([]byte, error) {
+	aead, prs := k.keys[keyId]
+
+	if !prs {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyId)
+	}
+
+	return open(aead, wrappedKey, additionalData)
+}
+
+func header(keyId string, wrappedKey []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.Write(magic)
+	buf.WriteByte(version)
+	buf.WriteByte(byte(len(keyId)))
+	buf.WriteString(keyId)
+	binary.Write(&buf, binary.BigEndian, uint16(len(wrappedKey)))
+	buf.Write(wrappedKey)
+
+	return buf.Bytes()
+}
+
+// the key id is prefixed with its length, as in the header, so that it can't
+// run into the object key
+func wrapAdditionalData(keyId string, objectKey string) []byte {
+	return append(append([]byte{byte(len(keyId))}, keyId...), objectKey...)
+}
+
+func contentAdditionalData(header []byte, objectKey string) []byte {
+	return append(append([]byte{}, header...), objectKey...)
+}
+
+type parsedHeader struct {
+	keyId      string
+	wrappedKey []byte
+	header     []byte
+	ciphertext []byte
+}
+
+func parseHeader(data []byte) (parsedHeader, error) {
+	if !IsEncrypted(data) {
+		return parsedHeader{}, fmt.Errorf("%w: no encryption header", ErrCorrupted)
+	}
+
+	rest := data[len(magic)+1:]
+
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+2 {
+		return parsedHeader{}, fmt.Errorf("%w: truncated header", ErrCorrupted)
+	}
+
+	keyId, rest := string(rest[1:1+int(rest[0])]), rest[1+int(rest[0]):]
+	wrappedKeyLength := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+
+	if len(rest) < wrappedKeyLength {
+		return parsedHeader{}, fmt.Errorf("%w: truncated header", ErrCorrupted)
+	}
+
+	headerLength := len(data) - len(rest) + wrappedKeyLength
+
+	return parsedHeader{
+		keyId:      keyId,
+		wrappedKey: rest[:wrappedKeyLength],
+		header:     data[:headerLength],
+		ciphertext: rest[wrappedKeyLength:],
+	}, nil
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal prepends a random nonce to the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated ciphertext", ErrCorrupted)
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+
+	return plaintext, nil
+}
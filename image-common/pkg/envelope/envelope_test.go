@@ -0,0 +1,96 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, currentId string, ids ...string) *Keyring {
+	keys := make(map[string][]byte)
+
+	for _, id := range append(ids, currentId) {
+		key := sha256.Sum256([]byte(id))
+		keys[id] = key[:]
+	}
+
+	keyring, err := NewKeyring(currentId, keys)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func TestEncrypt(t *testing.T) {
+	keyring := newTestKeyring(t, "k1")
+	plaintext := []byte("original")
+
+	encrypted, err := keyring.Encrypt("a/original.png", plaintext)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decrypted, err := keyring.Decrypt("a/original.png", encrypted); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected %q, got %q, %v", plaintext, decrypted, err)
+	}
+
+	if _, err := keyring.Decrypt("b/original.png", encrypted); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected a file under another key to fail authentication, got %v", err)
+	}
+
+	other, err := keyring.Encrypt("b/original.png", []byte("other"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the header of a file followed by the content of another one
+	parsed, _ := parseHeader(encrypted)
+	otherParsed, _ := parseHeader(other)
+	swapped := append(append([]byte{}, otherParsed.header...), parsed.ciphertext...)
+
+	if _, err := keyring.Decrypt("b/original.png", swapped); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected a swapped header to fail authentication, got %v", err)
+	}
+
+	downgraded := append([]byte{}, encrypted...)
+	downgraded[len(magic)] = 1
+
+	if _, err := keyring.Decrypt("a/original.png", downgraded); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected a file of another version to be refused, got %v", err)
+	}
+
+	if decrypted, err := keyring.Decrypt("a/original.png", plaintext); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected a clear file to be read as it is, got %q, %v", decrypted, err)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	oldKeyring := newTestKeyring(t, "k1")
+	keyring := newTestKeyring(t, "k2", "k1")
+	plaintext := []byte("original")
+
+	encrypted, err := oldKeyring.Encrypt("a/original.png", plaintext)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrapped, ok, err := keyring.Rewrap("a/original.png", encrypted)
+
+	if err != nil || !ok {
+		t.Fatalf("expected the file to be rewrapped, got %v, %v", ok, err)
+	}
+
+	if decrypted, err := newTestKeyring(t, "k2").Decrypt("a/original.png", rewrapped); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected the file to decrypt with the new key alone, got %q, %v", decrypted, err)
+	}
+
+	if _, ok, err := keyring.Rewrap("a/original.png", rewrapped); err != nil || ok {
+		t.Errorf("expected the file to be under the current key already, got %v, %v", ok, err)
+	}
+}
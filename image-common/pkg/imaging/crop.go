@@ -0,0 +1,102 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// FocalPoint is relative to the image size, {0.5, 0.5} is the center.
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func (p FocalPoint) Validate() error {
+	if p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+		return errors.New("Focal point coordinates must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// ParseAspectRatio reads ratios written as "16:9".
+func ParseAspectRatio(aspectRatio string) (float64, error) {
+	parts := strings.Split(aspectRatio, ":")
+
+	if len(parts) != 2 {
+		return 0, errors.New(fmt.Sprintf("Invalid aspect ratio %s", aspectRatio))
+	}
+
+	width, widthErr := strconv.ParseFloat(parts[0], 64)
+	height, heightErr := strconv.ParseFloat(parts[1], 64)
+
+	if widthErr != nil || heightErr != nil || width <= 0 || height <= 0 {
+		return 0, errors.New(fmt.Sprintf("Invalid aspect ratio %s", aspectRatio))
+	}
+
+	return width / height, nil
+}
+
+// CropToAspect cuts img down to the aspect ratio, keeping the focal point as
+// close to the center of the crop as the borders allow. Without a focal point
+// the crop falls back to the most detailed region found by SmartCrop.
+func CropToAspect(img image.Image, aspectRatio float64, focalPoint *FocalPoint) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	cropWidth, cropHeight := cropSize(width, height, aspectRatio)
+
+	if cropWidth == width && cropHeight == height {
+		return img
+	}
+
+	var origin image.Point
+
+	if focalPoint != nil {
+		origin = image.Pt(
+			clamp(int(focalPoint.X*float64(width))-cropWidth/2, 0, width-cropWidth),
+			clamp(int(focalPoint.Y*float64(height))-cropHeight/2, 0, height-cropHeight),
+		)
+	} else {
+		origin = SmartCrop(img, cropWidth, cropHeight)
+	}
+
+	return Crop(img, image.Rectangle{Min: origin, Max: origin.Add(image.Pt(cropWidth, cropHeight))}.Add(bounds.Min))
+}
+
+// SmartFocalPoint turns the SmartCrop window into a focal point, so that a
+// sequence of frames can share the crop chosen for the first one.
+func SmartFocalPoint(img image.Image, aspectRatio float64) *FocalPoint {
+	bounds := img.Bounds()
+	cropWidth, cropHeight := cropSize(bounds.Dx(), bounds.Dy(), aspectRatio)
+	origin := SmartCrop(img, cropWidth, cropHeight)
+
+	return &FocalPoint{
+		X: (float64(origin.X) + float64(cropWidth)/2) / float64(bounds.Dx()),
+		Y: (float64(origin.Y) + float64(cropHeight)/2) / float64(bounds.Dy()),
+	}
+}
+
+func cropSize(width int, height int, aspectRatio float64) (int, int) {
+	if float64(width)/float64(height) > aspectRatio {
+		return max(1, int(math.Round(float64(height)*aspectRatio))), height
+	}
+
+	return width, max(1, int(math.Round(float64(width)/aspectRatio)))
+}
+
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+
+	return cropped
+}
+
+func clamp(value int, low int, high int) int {
+	return max(low, min(value, high))
+}
@@ -0,0 +1,102 @@
+package imaging_test
+
+import (
+	"image"
+	"image-common/pkg/imaging"
+	"image/color"
+	"testing"
+)
+
+// newGradient encodes the coordinates of every pixel in its color, so the
+// origin of a crop can be read from its first pixel.
+func newGradient(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+
+	return img
+}
+
+func cropOrigin(img image.Image) image.Point {
+	c := color.RGBAModel.Convert(img.At(img.Bounds().Min.X, img.Bounds().Min.Y)).(color.RGBA)
+	return image.Pt(int(c.R), int(c.G))
+}
+
+func TestCropToAspectAnchorsFocalPoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		ratio      float64
+		focalPoint imaging.FocalPoint
+		origin     image.Point
+	}{
+		{"Center", 100, 50, 1, imaging.FocalPoint{X: 0.5, Y: 0.5}, image.Pt(25, 0)},
+		{"LeftEdge", 100, 50, 1, imaging.FocalPoint{X: 0, Y: 0.5}, image.Pt(0, 0)},
+		{"RightEdge", 100, 50, 1, imaging.FocalPoint{X: 1, Y: 0.5}, image.Pt(50, 0)},
+		{"NearLeftEdge", 100, 50, 1, imaging.FocalPoint{X: 0.1, Y: 0}, image.Pt(0, 0)},
+		{"OffCenter", 100, 50, 1, imaging.FocalPoint{X: 0.6, Y: 1}, image.Pt(35, 0)},
+		{"TopEdge", 50, 100, 1, imaging.FocalPoint{X: 0.5, Y: 0}, image.Pt(0, 0)},
+		{"BottomEdge", 50, 100, 1, imaging.FocalPoint{X: 0.5, Y: 1}, image.Pt(0, 50)},
+		{"Corner", 100, 100, 2, imaging.FocalPoint{X: 1, Y: 1}, image.Pt(0, 50)},
+	}
+
+	for _, test := range tests {
+		cropped := imaging.CropToAspect(newGradient(test.width, test.height), test.ratio, &test.focalPoint)
+		size := cropped.Bounds().Size()
+
+		if float64(size.X)/float64(size.Y) != test.ratio {
+			t.Errorf("%s: expected the aspect ratio %g, got %s", test.name, test.ratio, size)
+		}
+
+		if origin := cropOrigin(cropped); origin != test.origin {
+			t.Errorf("%s: expected the crop at %s, got %s", test.name, test.origin, origin)
+		}
+	}
+}
+
+func TestCropToAspectKeepsMatchingImages(t *testing.T) {
+	img := newGradient(40, 30)
+
+	if cropped := imaging.CropToAspect(img, 4.0/3, &imaging.FocalPoint{X: 1, Y: 1}); cropped != image.Image(img) {
+		t.Error("expected an image of the aspect ratio to be returned as it is")
+	}
+}
+
+func TestSmartCropFindsDetail(t *testing.T) {
+	tests := []struct {
+		name        string
+		detail      image.Rectangle
+		origin      image.Point
+		focalPointX float64
+	}{
+		{"Left", image.Rect(0, 0, 20, 50), image.Pt(0, 0), 0.25},
+		{"Right", image.Rect(80, 0, 100, 50), image.Pt(50, 0), 0.75},
+	}
+
+	for _, test := range tests {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+
+		// a checkerboard in the detailed region, the rest is flat
+		for y := test.detail.Min.Y; y < test.detail.Max.Y; y++ {
+			for x := test.detail.Min.X; x < test.detail.Max.X; x++ {
+				if (x/2+y/2)%2 == 0 {
+					img.Set(x, y, color.White)
+				}
+			}
+		}
+
+		if origin := imaging.SmartCrop(img, 50, 50); origin != test.origin {
+			t.Errorf("%s: expected the crop at %s, got %s", test.name, test.origin, origin)
+		}
+
+		// the center of the smart crop
+		if focalPoint := imaging.SmartFocalPoint(img, 1); focalPoint.X != test.focalPointX || focalPoint.Y != 0.5 {
+			t.Errorf("%s: expected the focal point at %g, got %+v", test.name, test.focalPointX, focalPoint)
+		}
+	}
+}
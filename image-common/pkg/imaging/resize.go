@@ -0,0 +1,46 @@
+package imaging
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit scales img down to fit into maxWidth x maxHeight keeping its aspect
+// ratio, a zero bound leaves that side unconstrained.
+func Fit(img image.Image, maxWidth int, maxHeight int) image.Image {
+	width, height := FitSize(img.Bounds().Dx(), img.Bounds().Dy(), maxWidth, maxHeight)
+
+	if width == img.Bounds().Dx() && height == img.Bounds().Dy() {
+		return img
+	}
+
+	return Resize(img, width, height)
+}
+
+func FitSize(width int, height int, maxWidth int, maxHeight int) (int, int) {
+	scale := 1.0
+
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+
+	if maxHeight > 0 && height > maxHeight {
+		if heightScale := float64(maxHeight) / float64(height); heightScale < scale {
+			scale = heightScale
+		}
+	}
+
+	if scale == 1.0 {
+		return width, height
+	}
+
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+func Resize(img image.Image, width int, height int) image.Image {
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	return resized
+}
@@ -0,0 +1,95 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+const smartCropAnalysisSize = 128
+
+// SmartCrop finds the origin of the cropWidth x cropHeight window holding the
+// most detail. Detail is measured as the luminance gradient energy of a
+// downscaled copy, which tracks edges and texture of the subject while
+// ignoring flat backgrounds; windows closer to the center win ties.
+func SmartCrop(img image.Image, cropWidth int, cropHeight int) image.Point {
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(smartCropAnalysisSize)/float64(max(bounds.Dx(), bounds.Dy())))
+	width := max(1, int(float64(bounds.Dx())*scale))
+	height := max(1, int(float64(bounds.Dy())*scale))
+	windowWidth := clamp(int(math.Round(float64(cropWidth)*scale)), 1, width)
+	windowHeight := clamp(int(math.Round(float64(cropHeight)*scale)), 1, height)
+
+	luminance := luminanceMap(Resize(img, width, height), width, height)
+	energy := newIntegral(width, height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx := luminance[y*width+min(x+1, width-1)] - luminance[y*width+max(x-1, 0)]
+			dy := luminance[min(y+1, height-1)*width+x] - luminance[max(y-1, 0)*width+x]
+			energy.set(x, y, math.Abs(dx)+math.Abs(dy))
+		}
+	}
+
+	best := image.Point{}
+	bestScore := math.Inf(-1)
+	centerX := float64(width-windowWidth) / 2
+	centerY := float64(height-windowHeight) / 2
+
+	for y := 0; y <= height-windowHeight; y++ {
+		for x := 0; x <= width-windowWidth; x++ {
+			distance := math.Hypot(float64(x)-centerX, float64(y)-centerY)
+			score := energy.sum(x, y, windowWidth, windowHeight) - distance*1e-6
+
+			if score > bestScore {
+				bestScore = score
+				best = image.Pt(x, y)
+			}
+		}
+	}
+
+	return image.Pt(
+		clamp(int(float64(best.X)/scale), 0, bounds.Dx()-cropWidth),
+		clamp(int(float64(best.Y)/scale), 0, bounds.Dy()-cropHeight),
+	)
+}
+
+func luminanceMap(img image.Image, width int, height int) []float64 {
+	luminance := make([]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			luminance[y*width+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+		}
+	}
+
+	return luminance
+}
+
+// integral is a summed-area table, giving the sum of any window in O(1).
+type integral struct {
+	width  int
+	values []float64
+}
+
+func newIntegral(width int, height int) *integral {
+	return &integral{
+		width + 1,
+		make([]float64, (width+1)*(height+1)),
+	}
+}
+
+// set must be called in row-major order.
+func (t *integral) set(x int, y int, value float64) {
+	t.values[(y+1)*t.width+x+1] = value +
+		t.values[y*t.width+x+1] +
+		t.values[(y+1)*t.width+x] -
+		t.values[y*t.width+x]
+}
+
+func (t *integral) sum(x int, y int, width int, height int) float64 {
+	return t.values[(y+height)*t.width+x+width] -
+		t.values[y*t.width+x+width] -
+		t.values[(y+height)*t.width+x] +
+		t.values[y*t.width+x]
+}
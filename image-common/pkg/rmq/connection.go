@@ -0,0 +1,262 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var ErrDisconnected = errors.New("RabbitMQ is unavailable, the connection is being restored")
+
+// Setup declares the topology a channel needs, it runs again on every new
+// channel after a reconnect.
+type Setup func(rmqChannel *amqp.Channel) error
+
+// Connection keeps a connection and a channel in confirm mode open,
+// reconnecting with backoff whenever the broker closes either of them.
+type Connection struct {
+	url        string
+	setup      Setup
+	mu         sync.RWMutex
+	connection *amqp.Connection
+	channel    *amqp.Channel
+	ready      chan struct{}
+	closed     bool
+}
+
+// Dial fails when the first connection can't be made, later failures are
+// retried in the background.
+func Dial(url string, setup Setup) (*Connection, error) {
+	c := &Connection{
+		url:   url,
+		setup: setup,
+		ready: make(chan struct{}),
+	}
+
+	closeNotifications, err := c.connect()
+
+	if err != nil {
+		return nil, err
+	}
+
+	go c.watch(closeNotifications)
+
+	return c, nil
+}
+
+// Channel returns ErrDisconnected while the connection is being restored.
+func (c *Connection) Channel() (*amqp.Channel, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.channel == nil {
+		return nil, ErrDisconnected
+	}
+
+	return c.channel, nil
+}
+
+// WaitChannel blocks until the connection is up or ctx is done.
+func (c *Connection) WaitChannel(ctx context.Context) (*amqp.Channel, error) {
+	for {
+		c.mu.RLock()
+		channel, ready, closed := c.channel, c.ready, c.closed
+		c.mu.RUnlock()
+
+		if closed {
+			return nil, amqp.ErrClosed
+		}
+
+		if channel != nil {
+			return channel, nil
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// OpenChannel opens another channel on the connection once it is up, so that
+// consumers don't share the flow control and the errors of the publishes.
+// The caller closes it, it is closed with the connection.
+func (c *Connection) OpenChannel(ctx context.Context) (*amqp.Channel, error) {
+	if _, err := c.WaitChannel(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	connection := c.connection
+	c.mu.RUnlock()
+
+	if connection == nil {
+		return nil, ErrDisconnected
+	}
+
+	return connection.Channel()
+}
+
+// Publish sends the message to the default exchange and waits for the broker
+// to confirm it, so callers can settle work that depends on the message.
+func (c *Connection) Publish(routingKey string, publishing amqp.Publishing) error {
+	channel, err := c.Channel()
+
+	if err != nil {
+		return err
+	}
+
+	// the broker acks persistent messages once they are written to disk
+	return publishConfirmed(channel, routingKey, publishing)
+}
+
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.channel = nil
+
+	if c.connection == nil {
+		return nil
+	}
+
+	return c.connection.Close()
+}
+
+func (c *Connection) connect() (chan *amqp.Error, error) {
+	connection, err := amqp.Dial(c.url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := c.openChannel(connection)
+
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	// one buffer for both, whichever closes first triggers the reconnect
+	closeNotifications := make(chan *amqp.Error, 2)
+	connection.NotifyClose(forward(closeNotifications))
+	channel.NotifyClose(forward(closeNotifications))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		connection.Close()
+		return nil, amqp.ErrClosed
+	}
+
+	c.connection = connection
+	c.channel = channel
+	close(c.ready)
+
+	return closeNotifications, nil
+}
+
+func (c *Connection) openChannel(connection *amqp.Connection) (*amqp.Channel, error) {
+	channel, err := openConfirmChannel(connection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.setup != nil {
+		err = c.setup(channel)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+func (c *Connection) watch(closeNotifications chan *amqp.Error) {
+	for {
+		closeErr := <-closeNotifications
+
+		c.mu.Lock()
+
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+
+		connection := c.connection
+		c.connection = nil
+		c.channel = nil
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+
+		fmt.Println(fmt.Sprintf("%s: %v", "RabbitMQ connection lost, reconnecting", closeErr))
+
+		// the connection may still be open when only the channel was closed
+		connection.Close()
+
+		closeNotifications = c.reconnect()
+
+		if closeNotifications == nil {
+			return
+		}
+
+		fmt.Println("RabbitMQ connection restored")
+	}
+}
+
+// reconnect returns nil once the connection is closed for good.
+func (c *Connection) reconnect() chan *amqp.Error {
+	delay := minReconnectDelay
+
+	for !c.isClosed() {
+		closeNotifications, err := c.connect()
+
+		if err == nil {
+			return closeNotifications
+		}
+
+		fmt.Println(fmt.Sprintf("Failed to reconnect to RabbitMQ, retrying in %s: %s", delay, err))
+
+		time.Sleep(delay)
+		delay = min(delay*2, maxReconnectDelay)
+	}
+
+	return nil
+}
+
+func (c *Connection) isClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.closed
+}
+
+// forward adapts the shared buffer to NotifyClose, which closes the channel
+// it is given and would otherwise close it for the other listener too.
+func forward(closeNotifications chan *amqp.Error) chan *amqp.Error {
+	notification := make(chan *amqp.Error, 1)
+
+	go func() {
+		if err, ok := <-notification; ok {
+			closeNotifications <- err
+		} else {
+			closeNotifications <- nil
+		}
+	}()
+
+	return notification
+}
@@ -0,0 +1,152 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MigrateQueue recreates name as durable when an older version declared it
+// non-durable, which makes declaring it fail with PRECONDITION_FAILED. Its
+// messages are kept in a temporary queue meanwhile, publishers and consumers
+// of name must be stopped. It returns the number of messages moved back.
+func MigrateQueue(url string, name string) (int, error) {
+	connection, err := amqp.Dial(url)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer connection.Close()
+
+	channel, err := openConfirmChannel(connection)
+
+	if err != nil {
+		return 0, err
+	}
+
+	tempName := name + ".migrating"
+	_, err = channel.QueueDeclare(name, true, false, false, false, nil)
+
+	var amqpErr *amqp.Error
+
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		// the failed declaration closed the channel
+		channel, err = openConfirmChannel(connection)
+
+		if err == nil {
+			err = recreateDurable(channel, name, tempName)
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// also resumes a migration interrupted after the queue was recreated
+	_, err = channel.QueueDeclare(tempName, true, false, false, false, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	moved, err := moveMessages(channel, tempName, name)
+
+	if err != nil {
+		return moved, err
+	}
+
+	_, err = channel.QueueDelete(tempName, false, true, false)
+
+	return moved, err
+}
+
+func recreateDurable(channel *amqp.Channel, name string, tempName string) error {
+	_, err := channel.QueueDeclare(tempName, true, false, false, false, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := moveMessages(channel, name, tempName); err != nil {
+		return err
+	}
+
+	// ifEmpty, a message published meanwhile makes the deletion fail
+	_, err = channel.QueueDelete(name, false, true, false)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = channel.QueueDeclare(name, true, false, false, false, nil)
+
+	return err
+}
+
+// moveMessages acks every message once the broker has confirmed its copy.
+func moveMessages(channel *amqp.Channel, from string, to string) (int, error) {
+	moved := 0
+
+	for {
+		message, ok, err := channel.Get(from, false)
+
+		if err != nil || !ok {
+			return moved, err
+		}
+
+		err = publishConfirmed(channel, to, amqp.Publishing{
+			Headers:      message.Headers,
+			ContentType:  message.ContentType,
+			DeliveryMode: amqp.Persistent,
+			Body:         message.Body,
+		})
+
+		if err != nil {
+			message.Reject(true)
+			return moved, err
+		}
+
+		if err := message.Ack(false); err != nil {
+			return moved, err
+		}
+
+		moved++
+	}
+}
+
+func publishConfirmed(channel *amqp.Channel, routingKey string, publishing amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, "", routingKey, false, false, publishing)
+
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if !acked {
+		return errors.New(fmt.Sprintf("Message to %s queue was rejected by the broker", routingKey))
+	}
+
+	return nil
+}
+
+func openConfirmChannel(connection *amqp.Connection) (*amqp.Channel, error) {
+	channel, err := connection.Channel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return channel, channel.Confirm(false)
+}
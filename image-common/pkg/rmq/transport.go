@@ -0,0 +1,234 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image-common/pkg/transport"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Transport implements transport.Transport on RabbitMQ. Declared queues are
+// remembered and declared again on every channel after a reconnect. Every
+// consumer has a channel of its own, the one of the connection publishes.
+type Transport struct {
+	connection   *Connection
+	mu           sync.Mutex
+	declarations []declaration
+}
+
+type declaration struct {
+	name    string
+	options transport.QueueOptions
+}
+
+type delivery struct {
+	delivery amqp.Delivery
+}
+
+func NewTransport(url string) (*Transport, error) {
+	t := &Transport{}
+
+	connection, err := Dial(url, t.setup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.connection = connection
+
+	return t, nil
+}
+
+func (t *Transport) Close() error {
+	return t.connection.Close()
+}
+
+func (t *Transport) DeclareQueue(name string, options transport.QueueOptions) error {
+	t.mu.Lock()
+	t.declarations = append(t.declarations, declaration{name, options})
+	t.mu.Unlock()
+
+	channel, err := t.connection.Channel()
+
+	if err != nil {
+		// declared by setup once the connection is back
+		return nil
+	}
+
+	return declareQueue(channel, name, options)
+}
+
+func (t *Transport) Publish(queue string, message transport.Message) error {
+	return t.connection.Publish(queue, amqp.Publishing{
+		Headers:      amqp.Table(message.Headers),
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         message.Body,
+	})
+}
+
+// Consume starts over on a new channel whenever the connection is restored.
+// Deliveries in progress when the connection drops can't be settled anymore,
+// the broker redelivers them.
+func (t *Transport) Consume(ctx context.Context, queue string, options transport.ConsumeOptions, handle func(delivery transport.Delivery)) error {
+	for {
+		channel, err := t.connection.OpenChannel(ctx)
+
+		if ctx.Err() != nil || t.connection.isClosed() {
+			return nil
+		}
+
+		if err == nil {
+			err = consume(ctx, channel, queue, options, handle)
+			channel.Close()
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to start consuming", err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		fmt.Println(fmt.Sprintf("Consumer of %s stopped, resuming once RabbitMQ is available", queue))
+	}
+}
+
+// consume returns once the channel is closed or ctx is done and the
+// deliveries handed out are handled.
+func consume(
+	ctx context.Context,
+	channel *amqp.Channel,
+	queue string,
+	options transport.ConsumeOptions,
+	handle func(delivery transport.Delivery),
+) error {
+	prefetch := options.Prefetch
+
+	if prefetch == 0 {
+		prefetch = options.Concurrency
+	}
+
+	// without a prefetch limit the broker pushes the whole queue to one consumer
+	err := channel.Qos(prefetch, 0, false)
+
+	if err != nil {
+		return err
+	}
+
+	messages, err := channel.ConsumeWithContext(
+		ctx,
+		queue, // queue
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for message := range messages {
+				handle(&delivery{message})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (t *Transport) Get(queue string) (transport.Delivery, bool, error) {
+	channel, err := t.connection.Channel()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	message, ok, err := channel.Get(queue, false)
+
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	return &delivery{message}, true, nil
+}
+
+func (t *Transport) setup(channel *amqp.Channel) error {
+	t.mu.Lock()
+	declarations := append([]declaration(nil), t.declarations...)
+	t.mu.Unlock()
+
+	for _, d := range declarations {
+		if err := declareQueue(channel, d.name, d.options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// declareQueue makes delay queues out of a message TTL and dead-lettering
+// back to the target.
+func declareQueue(channel *amqp.Channel, name string, options transport.QueueOptions) error {
+	var args amqp.Table
+
+	if options.Delay > 0 {
+		args = amqp.Table{
+			"x-message-ttl":             options.Delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": options.DelayTarget,
+		}
+	}
+
+	_, err := channel.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		args,  // arguments
+	)
+
+	var amqpErr *amqp.Error
+
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("%w: %s was declared with other options, see the migrate-queues command of image-saver", err, name)
+	}
+
+	return err
+}
+
+func (d *delivery) Message() transport.Message {
+	return transport.Message{
+		Body:    d.delivery.Body,
+		Headers: d.delivery.Headers,
+	}
+}
+
+func (d *delivery) Ack() error {
+	return d.delivery.Ack(false)
+}
+
+func (d *delivery) Reject(requeue bool) error {
+	return d.delivery.Reject(requeue)
+}
@@ -0,0 +1,198 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"image-common/pkg/transport"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TestReconnect runs against the broker of TestRMQUrl through a proxy that
+// drops the connections, as a broker restart does.
+func TestReconnect(t *testing.T) {
+	rmqUrl := os.Getenv("TestRMQUrl")
+
+	if rmqUrl == "" {
+		t.Skip("TestRMQUrl is not set")
+	}
+
+	brokerUrl, err := url.Parse(rmqUrl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := newTestProxy(t, brokerUrl.Host)
+	brokerUrl.Host = proxy.addr()
+
+	rmqTransport, err := NewTransport(brokerUrl.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rmqTransport.Close()
+
+	queue := fmt.Sprintf("test-reconnect-%d", time.Now().UnixNano())
+	cleanupQueue(t, rmqUrl, queue)
+
+	if err := rmqTransport.DeclareQueue(queue, transport.QueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 10)
+	consumerDone := make(chan struct{})
+
+	go func() {
+		rmqTransport.Consume(ctx, queue, transport.ConsumeOptions{Concurrency: 1}, func(delivery transport.Delivery) {
+			received <- string(delivery.Message().Body)
+			delivery.Ack()
+		})
+
+		close(consumerDone)
+	}()
+
+	publish(t, rmqTransport, queue, "before")
+	waitForBody(t, received, "before")
+
+	proxy.dropConnections()
+
+	// fails with ErrDisconnected until the connection is restored
+	publish(t, rmqTransport, queue, "after")
+	waitForBody(t, received, "after")
+
+	cancel()
+
+	select {
+	case <-consumerDone:
+	case <-time.After(10 * time.Second):
+		t.Error("expected the consumer to stop once ctx is done")
+	}
+}
+
+func publish(t *testing.T, rmqTransport *Transport, queue string, body string) {
+	t.Helper()
+
+	deadline := time.Now().Add(30 * time.Second)
+
+	for {
+		err := rmqTransport.Publish(queue, transport.Message{Body: []byte(body)})
+
+		if err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the message to be published once reconnected, got %s", err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func waitForBody(t *testing.T, received chan string, expected string) {
+	t.Helper()
+
+	timeout := time.After(30 * time.Second)
+
+	for {
+		select {
+		case body := <-received:
+			// a message published while the connection dropped may come again
+			if body == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("expected the message %s to be consumed", expected)
+		}
+	}
+}
+
+func cleanupQueue(t *testing.T, rmqUrl string, queue string) {
+	t.Cleanup(func() {
+		connection, err := amqp.Dial(rmqUrl)
+
+		if err != nil {
+			return
+		}
+
+		defer connection.Close()
+
+		if channel, err := connection.Channel(); err == nil {
+			channel.QueueDelete(queue, false, false, false)
+		}
+	})
+}
+
+type testProxy struct {
+	listener    net.Listener
+	target      string
+	mu          sync.Mutex
+	connections []net.Conn
+}
+
+func newTestProxy(t *testing.T, target string) *testProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProxy{listener: listener, target: target}
+	t.Cleanup(func() {
+		listener.Close()
+		p.dropConnections()
+	})
+
+	go p.serve()
+
+	return p
+}
+
+func (p *testProxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *testProxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		broker, err := net.Dial("tcp", p.target)
+
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		p.mu.Lock()
+		p.connections = append(p.connections, client, broker)
+		p.mu.Unlock()
+
+		go io.Copy(broker, client)
+		go io.Copy(client, broker)
+	}
+}
+
+func (p *testProxy) dropConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, connection := range p.connections {
+		connection.Close()
+	}
+
+	p.connections = nil
+}
@@ -0,0 +1,125 @@
+// Package storageConfig reads the settings of the storage the services share
+// from the environment. Both services must be given the same ones.
+package storageConfig
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image-common/pkg/blob"
+	"image-common/pkg/envelope"
+	"image-common/pkg/storageKeys"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetStorageConfig selects the backend with StorageBackend, "s3" by default
+// or "filesystem" with the files under StoragePath. The files are replicated
+// to the backends of Secondary1StorageBackend, Secondary2StorageBackend and so
+// on, configured by the same variables with the same prefix.
+func GetStorageConfig() blob.Config {
+	config := getBackendConfig("")
+
+	for i := 1; os.Getenv(fmt.Sprintf("Secondary%dStorageBackend", i)) != ""; i++ {
+		config.Secondaries = append(config.Secondaries, getBackendConfig(fmt.Sprintf("Secondary%d", i)))
+	}
+
+	return config
+}
+
+func getBackendConfig(envPrefix string) blob.Config {
+	return blob.Config{
+		Backend: getEnvOrDefault(envPrefix+"StorageBackend", blob.BackendS3),
+		Path:    os.Getenv(envPrefix + "StoragePath"),
+		S3: blob.S3Config{
+			Bucket:          os.Getenv(envPrefix + "Bucket"),
+			AccessKeyId:     os.Getenv(envPrefix + "AccessKeyId"),
+			SecretAccessKey: os.Getenv(envPrefix + "SecretAccessKey"),
+			Endpoint:        os.Getenv(envPrefix + "Endpoint"),
+		},
+	}
+}
+
+// GetKeySchemes returns the key layout and, while objects are being moved to
+// it, the previous layout reads fall back to. The previous layout is only set
+// when PreviousStorageKeySharding is, "none" for the flat layout.
+func GetKeySchemes() (*storageKeys.Scheme, *storageKeys.Scheme) {
+	keys := getKeyScheme("")
+
+	if os.Getenv("PreviousStorageKeySharding") == "" {
+		return keys, nil
+	}
+
+	return keys, getKeyScheme("Previous")
+}
+
+// GetKeyScheme returns the current key layout, without the previous one.
+func GetKeyScheme() *storageKeys.Scheme {
+	return getKeyScheme("")
+}
+
+func getKeyScheme(envPrefix string) *storageKeys.Scheme {
+	variantSubpaths, err := strconv.ParseBool(getEnvOrDefault(envPrefix+"StorageVariantSubpaths", "false"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	keys, err := storageKeys.NewScheme(storageKeys.Config{
+		Prefix:          os.Getenv(envPrefix + "StorageKeyPrefix"),
+		Sharding:        getEnvOrDefault(envPrefix+"StorageKeySharding", storageKeys.ShardingNone),
+		OriginalsPrefix: os.Getenv(envPrefix + "StorageOriginalsPrefix"),
+		VariantSubpaths: variantSubpaths,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return keys
+}
+
+// GetKeyring reads the key-encryption keys of the originals from
+// EncryptionKeys, "id:base64" pairs separated by commas, new originals are
+// encrypted with the one of EncryptionKeyId. It is nil without EncryptionKeys.
+func GetKeyring() *envelope.Keyring {
+	value := os.Getenv("EncryptionKeys")
+
+	if value == "" {
+		return nil
+	}
+
+	keys := make(map[string][]byte)
+
+	for _, pair := range strings.Split(value, ",") {
+		id, encodedKey, found := strings.Cut(strings.TrimSpace(pair), ":")
+
+		if !found {
+			panic("EncryptionKeys must be a list of id:base64 pairs")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+
+		if err != nil {
+			panic(fmt.Sprintf("The key %s of EncryptionKeys is not valid base64", id))
+		}
+
+		keys[id] = key
+	}
+
+	keyring, err := envelope.NewKeyring(os.Getenv("EncryptionKeyId"), keys)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return keyring
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,276 @@
+package storageKeys
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	ShardingNone = "none"
+	ShardingHash = "hash"
+	ShardingDate = "date"
+)
+
+// MasterSuffix marks the un-watermarked copy image-saver keeps next to
+// every watermarked variant in the flat layout.
+const MasterSuffix = "-master"
+
+const originalSuffix = "-original"
+
+// IsPrivateName tells apart the names of masters and originals in the flat
+// layout, which must never be served as variants.
+func IsPrivateName(name string) bool {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	return strings.HasSuffix(base, MasterSuffix) || strings.HasSuffix(base, originalSuffix)
+}
+
+// The kinds of files Parse tells apart.
+const (
+	KindVariant   = "variant"
+	KindMaster    = "master"
+	KindOriginal  = "original"
+	KindJobMarker = "jobMarker"
+)
+
+// ErrMissingDate is returned for images without a creation date when the
+// keys are sharded by date.
+var ErrMissingDate = errors.New("The image has no creation date, which the date sharding requires")
+
+// Config describes the layout of the keys. The zero value is the flat layout
+// of "<id>.<format>", "<id>-master.<format>" and "<id>-original.<ext>".
+type Config struct {
+	// Prefix, a tenant name for example, comes before every key.
+	Prefix string
+	// Sharding puts the files of an image under "ab/cd/" from the hash of
+	// its id or under "2006/01/02/" from its creation date.
+	Sharding string
+	// OriginalsPrefix keeps the uploads waiting for conversion apart from
+	// the variants.
+	OriginalsPrefix string
+	// VariantSubpaths stores the files of an image in a directory of its
+	// own: "<id>/image.<format>", "<id>/master.<format>", "<id>/original.<ext>".
+	VariantSubpaths bool
+}
+
+type ImageRef struct {
+	Id          string
+	CreatedDate time.Time
+}
+
+// Key is what Parse reads from a key: the id of the image, or of the job for
+// markers, and the format, or the extension of originals.
+type Key struct {
+	Kind   string
+	Id     string
+	Format string
+}
+
+// Scheme builds the keys of the files of both services, they must use the
+// same configuration.
+type Scheme struct {
+	config Config
+}
+
+func NewScheme(config Config) (*Scheme, error) {
+	if config.Sharding == "" {
+		config.Sharding = ShardingNone
+	}
+
+	if config.Sharding != ShardingNone && config.Sharding != ShardingHash && config.Sharding != ShardingDate {
+		return nil, errors.New(fmt.Sprintf("Unknown key sharding %s", config.Sharding))
+	}
+
+	for _, prefix := range []string{config.Prefix, config.OriginalsPrefix} {
+		if err := validatePrefix(prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Scheme{config}, nil
+}
+
+// Flat returns the scheme of the zero Config.
+func Flat() *Scheme {
+	return &Scheme{Config{Sharding: ShardingNone}}
+}
+
+// Dated tells whether the keys depend on the creation date of the images.
+func (s *Scheme) Dated() bool {
+	return s.config.Sharding == ShardingDate
+}
+
+// Check returns ErrMissingDate for images the keys can't be built for.
+func (s *Scheme) Check(image ImageRef) error {
+	if s.Dated() && image.CreatedDate.IsZero() {
+		return fmt.Errorf("%w: %s", ErrMissingDate, image.Id)
+	}
+
+	return nil
+}
+
+func (s *Scheme) Variant(image ImageRef, format string) string {
+	if s.config.VariantSubpaths {
+		return s.imageDir(image) + "image." + format
+	}
+
+	return s.imageDir(image) + image.Id + "." + format
+}
+
+func (s *Scheme) Master(image ImageRef, format string) string {
+	if s.config.VariantSubpaths {
+		return s.imageDir(image) + "master." + format
+	}
+
+	return s.imageDir(image) + image.Id + MasterSuffix + "." + format
+}
+
+func (s *Scheme) Original(image ImageRef, ext string) string {
+	if s.config.OriginalsPrefix != "" {
+		return s.withPrefix(s.config.OriginalsPrefix+"/") + s.shard(image) + image.Id + "." + ext
+	}
+
+	if s.config.VariantSubpaths {
+		return s.imageDir(image) + "original." + ext
+	}
+
+	return s.imageDir(image) + image.Id + originalSuffix + "." + ext
+}
+
+// JobMarkers is the prefix of the markers image-saver records for the
+// formats of a job it has produced.
+func (s *Scheme) JobMarkers(jobId string) string {
+	return s.JobMarkersRoot() + jobId + "/"
+}
+
+// JobMarkersRoot is the prefix of the markers of every job.
+func (s *Scheme) JobMarkersRoot() string {
+	return s.withPrefix("jobs/")
+}
+
+func (s *Scheme) JobMarker(jobId string, format string) string {
+	return s.JobMarkers(jobId) + format
+}
+
+// Root is the prefix of every key of the scheme, empty without Prefix.
+func (s *Scheme) Root() string {
+	return s.withPrefix("")
+}
+
+// Parse reads back a key the scheme builds, ok is false for any other key.
+func (s *Scheme) Parse(key string) (parsed Key, ok bool) {
+	jobMarkers := s.JobMarkersRoot()
+
+	if strings.HasPrefix(key, jobMarkers) {
+		jobId, format, found := strings.Cut(strings.TrimPrefix(key, jobMarkers), "/")
+
+		return Key{KindJobMarker, jobId, format}, found && jobId != "" && format != "" && !strings.Contains(format, "/")
+	}
+
+	dir, base := path.Split(key)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	parsed.Format = strings.TrimPrefix(ext, ".")
+
+	switch {
+	case s.config.OriginalsPrefix != "" && strings.HasPrefix(key, s.withPrefix(s.config.OriginalsPrefix+"/")):
+		parsed.Kind, parsed.Id = KindOriginal, name
+	case s.config.VariantSubpaths:
+		dir, parsed.Id = path.Split(strings.TrimSuffix(dir, "/"))
+		parsed.Kind = map[string]string{"image": KindVariant, "master": KindMaster, "original": KindOriginal}[name]
+	case strings.HasSuffix(name, MasterSuffix):
+		parsed.Kind, parsed.Id = KindMaster, strings.TrimSuffix(name, MasterSuffix)
+	case strings.HasSuffix(name, originalSuffix):
+		parsed.Kind, parsed.Id = KindOriginal, strings.TrimSuffix(name, originalSuffix)
+	default:
+		parsed.Kind, parsed.Id = KindVariant, name
+	}
+
+	if parsed.Kind == "" || parsed.Id == "" || parsed.Format == "" {
+		return Key{}, false
+	}
+
+	image := ImageRef{Id: parsed.Id}
+
+	if s.Dated() {
+		// the shard is all that is known of the creation date
+		if len(dir) < len("2006/01/02/") {
+			return Key{}, false
+		}
+
+		createdDate, err := time.Parse("2006/01/02/", dir[len(dir)-len("2006/01/02/"):])
+
+		if err != nil {
+			return Key{}, false
+		}
+
+		image.CreatedDate = createdDate
+	}
+
+	// anything the loose reading above let through builds another key
+	var rebuilt string
+
+	switch parsed.Kind {
+	case KindVariant:
+		rebuilt = s.Variant(image, parsed.Format)
+	case KindMaster:
+		rebuilt = s.Master(image, parsed.Format)
+	case KindOriginal:
+		rebuilt = s.Original(image, parsed.Format)
+	}
+
+	if rebuilt != key {
+		return Key{}, false
+	}
+
+	return parsed, true
+}
+
+// imageDir ends with "/" unless it is the root of the store.
+func (s *Scheme) imageDir(image ImageRef) string {
+	dir := s.withPrefix(s.shard(image))
+
+	if s.config.VariantSubpaths {
+		dir += image.Id + "/"
+	}
+
+	return dir
+}
+
+func (s *Scheme) shard(image ImageRef) string {
+	switch s.config.Sharding {
+	case ShardingHash:
+		sum := sha256.Sum256([]byte(image.Id))
+		return hex.EncodeToString(sum[:1]) + "/" + hex.EncodeToString(sum[1:2]) + "/"
+	case ShardingDate:
+		return image.CreatedDate.UTC().Format("2006/01/02") + "/"
+	default:
+		return ""
+	}
+}
+
+func (s *Scheme) withPrefix(key string) string {
+	if s.config.Prefix == "" {
+		return key
+	}
+
+	return s.config.Prefix + "/" + key
+}
+
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return errors.New(fmt.Sprintf("Invalid key prefix %q", prefix))
+		}
+	}
+
+	return nil
+}
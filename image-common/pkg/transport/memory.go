@@ -0,0 +1,215 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps queues in the process, for development and tests that run
+// both services without a broker. Nothing survives a restart.
+type Memory struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+}
+
+type memoryQueue struct {
+	messages []Message
+	options  QueueOptions
+	// signal wakes a waiting consumer, each consumer passes it on while messages are left
+	signal chan struct{}
+}
+
+type memoryDelivery struct {
+	memory  *Memory
+	queue   string
+	message Message
+	settled bool
+	mu      sync.Mutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		queues: make(map[string]*memoryQueue),
+	}
+}
+
+func (m *Memory) DeclareQueue(name string, options QueueOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queue(name).options = options
+
+	return nil
+}
+
+func (m *Memory) Publish(queue string, message Message) error {
+	message = copyMessage(message)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := m.queue(queue)
+
+	if q.options.Delay > 0 {
+		time.AfterFunc(q.options.Delay, func() {
+			m.Publish(q.options.DelayTarget, message)
+		})
+
+		return nil
+	}
+
+	q.messages = append(q.messages, message)
+	q.wake()
+
+	return nil
+}
+
+// Consume takes messages only when a goroutine is free, the prefetch doesn't
+// apply.
+func (m *Memory) Consume(ctx context.Context, queue string, options ConsumeOptions, handle func(delivery Delivery)) error {
+	var wg sync.WaitGroup
+
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				delivery, ok := m.take(queue)
+
+				if ok {
+					handle(delivery)
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-m.signal(queue):
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func (m *Memory) Get(queue string) (Delivery, bool, error) {
+	delivery, ok := m.take(queue)
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	return delivery, true, nil
+}
+
+// Len is the number of messages waiting in the queue.
+func (m *Memory) Len(queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.queue(queue).messages)
+}
+
+func (m *Memory) take(queue string) (*memoryDelivery, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := m.queue(queue)
+
+	if len(q.messages) == 0 {
+		return nil, false
+	}
+
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+
+	if len(q.messages) > 0 {
+		q.wake()
+	}
+
+	return &memoryDelivery{memory: m, queue: queue, message: message}, true
+}
+
+func (m *Memory) signal(queue string) chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.queue(queue).signal
+}
+
+// queue must be called with mu held.
+func (m *Memory) queue(name string) *memoryQueue {
+	q, prs := m.queues[name]
+
+	if !prs {
+		q = &memoryQueue{signal: make(chan struct{}, 1)}
+		m.queues[name] = q
+	}
+
+	return q
+}
+
+func (q *memoryQueue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (d *memoryDelivery) Message() Message {
+	return d.message
+}
+
+func (d *memoryDelivery) Ack() error {
+	d.settle()
+	return nil
+}
+
+// Reject puts a requeued message back at the front of its queue, where the
+// broker would put it too.
+func (d *memoryDelivery) Reject(requeue bool) error {
+	if !d.settle() || !requeue {
+		return nil
+	}
+
+	d.memory.mu.Lock()
+	defer d.memory.mu.Unlock()
+
+	q := d.memory.queue(d.queue)
+	q.messages = append([]Message{d.message}, q.messages...)
+	q.wake()
+
+	return nil
+}
+
+func (d *memoryDelivery) settle() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.settled {
+		return false
+	}
+
+	d.settled = true
+
+	return true
+}
+
+func copyMessage(message Message) Message {
+	headers := make(map[string]interface{}, len(message.Headers))
+
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+
+	return Message{
+		Body:    append([]byte(nil), message.Body...),
+		Headers: headers,
+	}
+}
@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"context"
+	"time"
+)
+
+type Message struct {
+	Body    []byte
+	Headers map[string]interface{}
+}
+
+type Delivery interface {
+	Message() Message
+	Ack() error
+	Reject(requeue bool) error
+}
+
+// QueueOptions with a Delay declare a delay queue: nothing consumes it, its
+// messages move on to DelayTarget once Delay has passed.
+type QueueOptions struct {
+	Delay       time.Duration
+	DelayTarget string
+}
+
+// ConsumeOptions bound the deliveries of a consumer: Concurrency goroutines
+// handle them and at most Prefetch are held unacknowledged, Concurrency when
+// it is 0.
+type ConsumeOptions struct {
+	Concurrency int
+	Prefetch    int
+}
+
+// Transport carries messages between the services. Messages are persistent
+// and Publish returns once the transport has taken responsibility for them.
+type Transport interface {
+	DeclareQueue(name string, options QueueOptions) error
+	Publish(queue string, message Message) error
+	// Consume passes deliveries to handle from up to options.Concurrency
+	// goroutines. It returns once ctx is done and every delivery handed out
+	// is handled.
+	Consume(ctx context.Context, queue string, options ConsumeOptions, handle func(delivery Delivery)) error
+	// Get takes a single message off the queue, ok is false when it is empty.
+	Get(queue string) (delivery Delivery, ok bool, err error)
+}
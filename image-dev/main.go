@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image-common/pkg/blob"
+	"image-common/pkg/storageConfig"
+	"image-common/pkg/transport"
+	"image-saver/pkg/retry"
+	saverStorageAdapter "image-saver/pkg/storageAdapter"
+	"image-saver/pkg/worker"
+	"image-service/pkg/core"
+	"image-service/pkg/dbAdapter"
+	"image-service/pkg/queueAdapter"
+	"image-service/pkg/server"
+	"image-service/pkg/storageAdapter"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func failOnError(err error, msg string) {
+	if err != nil {
+		log.Panicf("%s: %s", msg, err)
+	}
+}
+
+// main runs image-service and the image-saver worker in one process, passing
+// messages over an in-memory bus instead of RabbitMQ. Messages are not
+// persisted, jobs still queued on exit are lost: this is for development only.
+func main() {
+	err := godotenv.Load()
+
+	failOnError(err, "")
+
+	queueName := os.Getenv("RMQQueueName")
+	retryConfig := retry.GetRetryConfig()
+	workerConfig := worker.GetWorkerConfig()
+
+	db, err := dbAdapter.Connect(dbAdapter.GetPgDbConfig())
+
+	failOnError(err, "")
+
+	defer db.Close()
+
+	err = dbAdapter.Migrate(db)
+
+	failOnError(err, "")
+
+	bus := transport.NewMemory()
+
+	err = queueAdapter.DeclareQueues(bus, queueName)
+
+	failOnError(err, "")
+
+	err = worker.DeclareQueues(bus, queueName, retryConfig)
+
+	failOnError(err, "")
+
+	// both sides share the store, as the services share a bucket or a volume
+	store, err := blob.Open(storageConfig.GetStorageConfig())
+
+	failOnError(err, "")
+
+	keys, previousKeys := storageConfig.GetKeySchemes()
+	keyring := storageConfig.GetKeyring()
+
+	saverStorage := saverStorageAdapter.NewStorageAdapter(store, keys, keyring)
+
+	imgWorker, err := worker.NewFromEnv(
+		saverStorage,
+		bus,
+		queueName,
+		retryConfig,
+		workerConfig,
+	)
+
+	failOnError(err, "")
+
+	var dataStorage core.DataStorage = storageAdapter.NewStorageAdapter(store, keys, previousKeys)
+
+	if keyring != nil {
+		dataStorage = storageAdapter.NewEncryptedStorage(dataStorage, keys, keyring)
+	}
+
+	imageServer := server.NewServer(
+		db,
+		dataStorage,
+		queueAdapter.NewQueueAdapter(bus, queueName),
+		server.GetServerConfig(),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if maxAge := saverStorageAdapter.GetJobMarkerMaxAge(); maxAge > 0 {
+		go saverStorage.CleanJobMarkers(maxAge, time.Hour, ctx.Done())
+	}
+
+	workerDone := make(chan struct{})
+
+	go func() {
+		err := imgWorker.Consume(ctx)
+
+		if err != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to consume messages", err))
+		}
+
+		close(workerDone)
+	}()
+
+	err = imageServer.Run(ctx, ":3000", workerConfig.ShutdownTimeout)
+
+	failOnError(err, "")
+
+	select {
+	case <-workerDone:
+	case <-time.After(workerConfig.ShutdownTimeout):
+		fmt.Println("Shutdown timed out, dropping messages in progress")
+	}
+}
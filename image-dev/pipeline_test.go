@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image-common/pkg/contracts"
+	"image-common/pkg/storageKeys"
+	"image-common/pkg/transport"
+	"image-saver/pkg/imageProcessor"
+	"image-saver/pkg/retry"
+	"image-saver/pkg/worker"
+	"image-service/pkg/queueAdapter"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const queueName = "imageQueue"
+
+var errNotFound = errors.New("not found")
+
+// memoryStorage stands in for the bucket image-saver works on.
+type memoryStorage struct {
+	mu        sync.Mutex
+	files     map[string][]byte
+	completed map[string]map[string]bool
+	failGets  int
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		files:     map[string][]byte{},
+		completed: map[string]map[string]bool{},
+	}
+}
+
+func (s *memoryStorage) GetFile(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failGets > 0 {
+		s.failGets--
+		return nil, errors.New("storage unavailable")
+	}
+
+	file, ok := s.files[name]
+
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return file, nil
+}
+
+func (s *memoryStorage) SaveImageFormat(image storageKeys.ImageRef, imageData imageProcessor.ImageData) error {
+	if imageData.Master {
+		s.put(storageKeys.Flat().Master(image, imageData.Format), imageData.File)
+	} else {
+		s.put(storageKeys.Flat().Variant(image, imageData.Format), imageData.File)
+	}
+
+	return nil
+}
+
+func (s *memoryStorage) put(name string, file []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[name] = file
+}
+
+func (s *memoryStorage) DeleteFile(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.files, name)
+
+	return nil
+}
+
+func (s *memoryStorage) IsNotFound(err error) bool {
+	return errors.Is(err, errNotFound)
+}
+
+func (s *memoryStorage) CompletedFormats(jobId string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	completed := map[string]bool{}
+
+	for format := range s.completed[jobId] {
+		completed[format] = true
+	}
+
+	return completed, nil
+}
+
+func (s *memoryStorage) DeleteJobMarkers(jobId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.completed, jobId)
+
+	return nil
+}
+
+func (s *memoryStorage) MarkCompleted(jobId string, format string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.completed[jobId] == nil {
+		s.completed[jobId] = map[string]bool{}
+	}
+
+	s.completed[jobId][format] = true
+
+	return nil
+}
+
+func (s *memoryStorage) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.files[name]
+
+	return ok
+}
+
+type pipeline struct {
+	bus     *transport.Memory
+	storage *memoryStorage
+	queue   *queueAdapter.QueueAdapter
+	results chan contracts.ConversionResult
+}
+
+// startPipeline wires the image-service queue adapter and the image-saver
+// worker over the in-memory bus, the way main does without the database.
+func startPipeline(t *testing.T) *pipeline {
+	bus := transport.NewMemory()
+	retryConfig := retry.RetryConfig{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	if err := queueAdapter.DeclareQueues(bus, queueName); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := worker.DeclareQueues(bus, queueName, retryConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := newMemoryStorage()
+
+	imgWorker, err := worker.NewFromEnv(storage, bus, queueName, retryConfig, worker.WorkerConfig{
+		Workers:           2,
+		BulkWorkers:       1,
+		Prefetch:          2,
+		BulkPrefetch:      1,
+		FormatConcurrency: 2,
+		ShutdownTimeout:   time.Second,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &pipeline{
+		bus,
+		storage,
+		queueAdapter.NewQueueAdapter(bus, queueName),
+		make(chan contracts.ConversionResult, 10),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		imgWorker.Consume(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+		p.queue.ConsumeResults(ctx, func(result contracts.ConversionResult) error {
+			p.results <- result
+			return nil
+		})
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	return p
+}
+
+func (p *pipeline) publish(t *testing.T, job contracts.ConversionJob) {
+	// what the outbox relay does with the jobs image-service writes
+	if err := p.queue.PublishToQueue(job, job.Priority); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *pipeline) awaitResult(t *testing.T) contracts.ConversionResult {
+	select {
+	case result := <-p.results:
+		return result
+	case <-time.After(10 * time.Second):
+		t.Fatal("no conversion result received")
+		return contracts.ConversionResult{}
+	}
+}
+
+func newPng(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 10), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// newPngBomb declares a huge size in the header of a tiny png, decoding it
+// would allocate 10 GB.
+func newPngBomb(t *testing.T) []byte {
+	file := newPng(t)
+
+	// IHDR data follows the 8 byte signature and the chunk length and type
+	binary.BigEndian.PutUint32(file[16:], 50000)
+	binary.BigEndian.PutUint32(file[20:], 50000)
+	binary.BigEndian.PutUint32(file[29:], crc32.ChecksumIEEE(file[12:29]))
+
+	return file
+}
+
+func newJob(jobId string, originalImageName string) contracts.ConversionJob {
+	return contracts.ConversionJob{
+		Version:           contracts.ConversionJobVersion,
+		JobId:             jobId,
+		OriginalImageName: originalImageName,
+		SaveName:          jobId,
+		SaveFormats:       []string{"png", "webp"},
+	}
+}
+
+func TestPipelineConvertsImage(t *testing.T) {
+	p := startPipeline(t)
+	p.storage.put("original.png", newPng(t))
+
+	p.publish(t, newJob("6a0f4b1e-8f5e-4d4a-9a36-0c1f7d2b8e11", "original.png"))
+
+	result := p.awaitResult(t)
+
+	if result.Status != contracts.ResultCompleted {
+		t.Fatalf("expected a completed result, got %+v", result)
+	}
+
+	for _, name := range []string{result.SaveName + ".png", result.SaveName + ".webp"} {
+		if !p.storage.has(name) {
+			t.Errorf("expected %s to be saved", name)
+		}
+	}
+
+	if p.storage.has("original.png") {
+		t.Error("expected the original to be deleted")
+	}
+}
+
+func TestPipelineConvertsBulkJobs(t *testing.T) {
+	p := startPipeline(t)
+	p.storage.put("original.png", newPng(t))
+
+	job := newJob("f3a91c2d-5b6e-4f70-8c1d-9e2b3a4f5d61", "original.png")
+	job.Priority = contracts.PriorityBulk
+	p.publish(t, job)
+
+	result := p.awaitResult(t)
+
+	if result.Status != contracts.ResultCompleted {
+		t.Fatalf("expected a completed result, got %+v", result)
+	}
+}
+
+func TestPipelineRetriesTransientErrors(t *testing.T) {
+	p := startPipeline(t)
+	p.storage.put("original.png", newPng(t))
+	p.storage.failGets = 1
+
+	p.publish(t, newJob("0b7c9d52-3f4e-4a61-8d2b-5e9f1a6c7d30", "original.png"))
+
+	result := p.awaitResult(t)
+
+	if result.Status != contracts.ResultCompleted {
+		t.Fatalf("expected a completed result after the retry, got %+v", result)
+	}
+
+	if n := p.bus.Len(retry.DeadLetterQueueName(queueName)); n != 0 {
+		t.Errorf("expected no dead-lettered message, got %d", n)
+	}
+}
+
+func TestPipelineDeadLettersInvalidImage(t *testing.T) {
+	p := startPipeline(t)
+	p.storage.put("original.png", []byte("not an image"))
+
+	p.publish(t, newJob("c4e2a8f1-7b3d-4c59-a0e6-2d8f9b1c4a57", "original.png"))
+
+	result := p.awaitResult(t)
+
+	if result.Status != contracts.ResultFailed || result.Error == "" {
+		t.Fatalf("expected a failed result with an error, got %+v", result)
+	}
+
+	if n := p.bus.Len(retry.DeadLetterQueueName(queueName)); n != 1 {
+		t.Errorf("expected the job to be dead-lettered, got %d messages", n)
+	}
+}
+
+func TestPipelineRejectsOversizedImages(t *testing.T) {
+	p := startPipeline(t)
+	p.storage.put("original.png", newPngBomb(t))
+
+	p.publish(t, newJob("8d1e6b3a-2c4f-4e7a-b5d9-1f0a3c6e8b24", "original.png"))
+
+	result := p.awaitResult(t)
+
+	if result.Status != contracts.ResultFailed || !strings.Contains(result.Error, "50000x50000") {
+		t.Fatalf("expected a failed result naming the size, got %+v", result)
+	}
+}
@@ -3,20 +3,17 @@ module image-saver
 go 1.21.2
 
 require (
-	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/chai2010/webp v1.4.0
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/image v0.18.0
+	image-common v0.0.0
+)
+
+require (
 	github.com/aws/aws-sdk-go v1.48.4 // indirect
-	github.com/gofiber/fiber/v2 v2.51.0 // indirect
-	github.com/google/uuid v1.4.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/klauspost/compress v1.16.7 // indirect
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rabbitmq/amqp091-go v1.9.0 // indirect
-	github.com/rivo/uniseg v0.2.0 // indirect
-	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.50.0 // indirect
-	github.com/valyala/tcplisten v1.0.0 // indirect
-	golang.org/x/sys v0.14.0 // indirect
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1 // indirect
 )
+
+replace image-common => ../image-common
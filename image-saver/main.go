@@ -1,29 +1,28 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-
-	"image-saver/pkg/imageProcessor"
-	s3Adapter "image-saver/pkg/s3"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"image-common/pkg/blob"
+	"image-common/pkg/contracts"
+	"image-common/pkg/rmq"
+	"image-common/pkg/storageConfig"
+	"image-common/pkg/transport"
+	"image-saver/pkg/retry"
+	"image-saver/pkg/storageAdapter"
+	"image-saver/pkg/worker"
 	"os"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/joho/godotenv"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-type ImageQueueMessageData struct {
-	OriginalImageName string   `json:"originalImageName"`
-	SaveName          string   `json:"saveName"`
-	SaveFormats       []string `json:"saveFormats"`
-}
-
 func failOnError(err error, msg string) {
 	if err != nil {
 		log.Panicf("%s: %s", msg, err)
@@ -35,135 +34,135 @@ func main() {
 
 	failOnError(err, "")
 
-	amqpConnection, err := rmqConnection()
+	queueName := os.Getenv("RMQQueueName")
+	retryConfig := retry.GetRetryConfig()
+	workerConfig := worker.GetWorkerConfig()
+
+	// before declaring the queues, which fails until they are migrated
+	if len(os.Args) > 1 && os.Args[1] == "migrate-queues" {
+		migrateQueuesCommand(os.Getenv("RMQUrl"), queueName)
+		return
+	}
+
+	rmqTransport, err := rmq.NewTransport(os.Getenv("RMQUrl"))
 
 	failOnError(err, "")
 
-	defer amqpConnection.Close()
+	defer rmqTransport.Close()
 
-	rmqChannel, err := amqpConnection.Channel()
+	err = worker.DeclareQueues(rmqTransport, queueName, retryConfig)
 
 	failOnError(err, "")
 
-	defer rmqChannel.Close()
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		deadLetterCommand(rmqTransport, queueName, os.Args[2:])
+		return
+	}
 
-	queue, err := rmqChannel.QueueDeclare(
-		os.Getenv("RMQQueueName"), // name
-		false,                     // durable
-		false,                     // delete when unused
-		false,                     // exclusive
-		false,                     // no-wait
-		nil,                       // arguments
-	)
+	store, err := blob.Open(storageConfig.GetStorageConfig())
 
 	failOnError(err, "")
 
-	messages, err := rmqChannel.Consume(
-		queue.Name, // queue
-		"",         // consumer
-		false,      // auto-ack
-		false,      // exclusive
-		false,      // no-local
-		false,      // no-wait
-		nil,        // args
+	saverStorage := storageAdapter.NewStorageAdapter(store, storageConfig.GetKeyScheme(), storageConfig.GetKeyring())
+
+	imgWorker, err := worker.NewFromEnv(
+		saverStorage,
+		rmqTransport,
+		queueName,
+		retryConfig,
+		workerConfig,
 	)
 
 	failOnError(err, "")
 
-	s3Client, uploader, bucketName, err := s3Connection()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	failOnError(err, "")
-
-	s3Adapter := s3Adapter.NewS3Adapter(s3Client, uploader, bucketName)
-	imgProcessor := imageProcessor.NewImageProcessor()
+	if maxAge := storageAdapter.GetJobMarkerMaxAge(); maxAge > 0 {
+		go saverStorage.CleanJobMarkers(maxAge, time.Hour, ctx.Done())
+	}
 
-	var forever chan struct{}
+	workerDone := make(chan struct{})
 
 	go func() {
-		for message := range messages {
-			messageStr := string(message.Body)
-			fmt.Println("received a message:", messageStr)
-
-			var imageQueueMessageData ImageQueueMessageData
-
-			err := json.Unmarshal(message.Body, &imageQueueMessageData)
-
-			if err == nil {
-				var originalImage []byte = []byte{}
-				originalImage, err = s3Adapter.GetFile(imageQueueMessageData.OriginalImageName)
-
-				if err == nil {
-					var processedImg *imageProcessor.ImageData
-
-					for _, format := range imageQueueMessageData.SaveFormats {
-						fmt.Println(format)
-						processedImg, err = imgProcessor.ConvertImage(
-							originalImage,
-							imageQueueMessageData.OriginalImageName,
-							imageQueueMessageData.SaveName,
-							format,
-						)
-
-						if err == nil {
-							err = s3Adapter.SaveImageFormat(*processedImg)
-						}
-
-						if err != nil {
-							break
-						}
-					}
-
-					if err == nil {
-						err = s3Adapter.DeleteFile(imageQueueMessageData.OriginalImageName)
-
-						if err != nil {
-							fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the original image file", err))
-						}
-					}
-				}
-			}
-
-			if err != nil {
-				fmt.Println(err)
-				message.Reject(false)
-			} else {
-				message.Ack(false)
-				fmt.Println("Image has been processed successfully")
-			}
+		err := imgWorker.Consume(ctx)
+
+		if err != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to consume messages", err))
 		}
+
+		close(workerDone)
 	}()
 
 	fmt.Println(" [*] Waiting for messages. To exit press CTRL+C")
-	<-forever
+	<-ctx.Done()
+
+	fmt.Println("Shutting down, waiting for messages in progress")
+
+	select {
+	case <-workerDone:
+	case <-time.After(workerConfig.ShutdownTimeout):
+		// unacknowledged messages are requeued by the broker when the channel closes
+		fmt.Println("Shutdown timed out, requeueing messages in progress")
+	}
 }
 
-func s3Connection() (*s3.S3, *s3manager.Uploader, string, error) {
-	s3Config := s3Adapter.GetS3Config()
-
-	awsConfig := aws.NewConfig()
-	awsConfig.Endpoint = &s3Config.Endpoint
-	awsConfig.Region = aws.String("us-east-2")
-	awsConfig.S3ForcePathStyle = aws.Bool(true)
-	awsConfig.Credentials = credentials.NewStaticCredentials(
-		s3Config.AccessKeyId,
-		s3Config.SecretAccessKey,
-		"",
-	)
+// migrateQueuesCommand recreates the job queue as durable, versions before
+// the durable queues declared it non-durable. The later queues were always
+// durable.
+func migrateQueuesCommand(url string, queueName string) {
+	moved, err := rmq.MigrateQueue(url, contracts.LaneQueueName(queueName, contracts.PriorityInteractive))
 
-	sess := session.Must(session.NewSession(awsConfig))
-	uploader := s3manager.NewUploader(sess)
-	s3Client := s3.New(sess, awsConfig)
+	failOnError(err, fmt.Sprintf("Moved %d messages", moved))
 
-	return s3Client, uploader, s3Config.Bucket, nil
+	fmt.Println(fmt.Sprintf("Migrated %s, %d messages kept", queueName, moved))
 }
 
-func rmqConnection() (*amqp.Connection, error) {
-	amqpServerURL := os.Getenv("RMQUrl")
+// deadLetterCommand serves "dlq list [limit]" and "dlq replay [limit]", the
+// limit applies to the dead-letter queue of every lane.
+func deadLetterCommand(t transport.Transport, queueName string, args []string) {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "replay") {
+		fmt.Println("usage: image-saver dlq list|replay [limit]")
+		os.Exit(2)
+	}
+
+	limit := 100
 
-	connectRabbitMQ, err := amqp.Dial(amqpServerURL)
-	if err != nil {
-		return nil, err
+	if len(args) > 1 {
+		parsed, err := strconv.Atoi(args[1])
+
+		if err != nil || parsed < 1 {
+			failOnError(errors.New("limit must be a positive integer"), "")
+		}
+
+		limit = parsed
 	}
 
-	return connectRabbitMQ, nil
+	for _, laneQueueName := range worker.LaneQueueNames(queueName) {
+		if args[0] == "replay" {
+			replayed, err := retry.ReplayDeadLetters(t, laneQueueName, limit)
+
+			failOnError(err, fmt.Sprintf("Replayed %d messages of %s", replayed, laneQueueName))
+
+			fmt.Println(fmt.Sprintf("Replayed %d messages of %s", replayed, laneQueueName))
+			continue
+		}
+
+		messages, err := retry.ListDeadLetters(t, laneQueueName, limit)
+
+		failOnError(err, "")
+
+		for _, message := range messages {
+			fmt.Println(fmt.Sprintf(
+				"attempts=%d failedAt=%v permanent=%v error=%q\n%s",
+				retry.Attempts(message),
+				message.Headers[retry.HeaderFailedAt],
+				message.Headers[retry.HeaderPermanent],
+				message.Headers[retry.HeaderError],
+				message.Body,
+			))
+		}
+
+		fmt.Println(fmt.Sprintf("%d dead-lettered messages of %s shown", len(messages), laneQueueName))
+	}
 }
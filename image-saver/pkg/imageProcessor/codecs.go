@@ -0,0 +1,288 @@
+package imageProcessor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image-common/pkg/codec"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/image/webp"
+)
+
+func NewCodecRegistry(config ImageProcessorConfig) (*codec.Registry, error) {
+	sandbox, err := NewSandbox(config.Sandbox)
+
+	if err != nil {
+		return nil, err
+	}
+
+	webpEncoder, err := NewWebpEncoder(config, sandbox)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.NewRegistry(
+		NewJpegCodec(sandbox),
+		codec.NewPngCodec(),
+		NewWebpCodec(webpEncoder, sandbox),
+		NewAvifCodec(sandbox),
+		codec.NewGifCodec(),
+		codec.NewBmpCodec(),
+		codec.NewTiffCodec(),
+	), nil
+}
+
+type jpegCodec struct {
+	codec.Codec
+	sandbox *Sandbox
+}
+
+func NewJpegCodec(sandbox *Sandbox) codec.Codec {
+	return &jpegCodec{
+		codec.NewJpegCodec(),
+		sandbox,
+	}
+}
+
+func (c *jpegCodec) Encode(w io.Writer, img image.Image, options codec.EncodeOptions) error {
+	if !options.IsProgressive() {
+		return c.Codec.Encode(w, img, options)
+	}
+
+	// image/jpeg only writes baseline files, progressive ones go through ImageMagick
+	encoded, err := c.sandbox.ConvertImage(
+		img,
+		"jpeg",
+		func(fullOriginalFileName string, fullConvertedFileName string) error {
+			return c.sandbox.Run(
+				"convert",
+				magickPath("png", fullOriginalFileName),
+				"-quality", formatFloat(options.QualityOr(jpeg.DefaultQuality)),
+				"-interlace", "JPEG",
+				magickPath("jpeg", fullConvertedFileName),
+			)
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(encoded)
+	return err
+}
+
+type webpCodec struct {
+	encoder Encoder
+	sandbox *Sandbox
+}
+
+func NewWebpCodec(encoder Encoder, sandbox *Sandbox) codec.AnimatedCodec {
+	return &webpCodec{
+		encoder,
+		sandbox,
+	}
+}
+
+func (c *webpCodec) Format() codec.Format {
+	return codec.Webp
+}
+
+func (c *webpCodec) Decode(r io.Reader) (image.Image, error) {
+	file, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !codec.IsAnimated(codec.Webp, file) {
+		return webp.Decode(bytes.NewReader(file))
+	}
+
+	// the Go decoder only reads still images, ImageMagick extracts the first frame
+	decoded, err := c.sandbox.Convert(
+		file,
+		"webp",
+		"png",
+		func(fullOriginalFileName string, fullConvertedFileName string) error {
+			return c.sandbox.Run(
+				"convert",
+				magickPath("webp", fullOriginalFileName)+"[0]",
+				magickPath("png", fullConvertedFileName),
+			)
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return png.Decode(bytes.NewReader(decoded))
+}
+
+func (c *webpCodec) Encode(w io.Writer, img image.Image, options codec.EncodeOptions) error {
+	encoded, err := c.encoder.Encode(img, WebpOptions{
+		Quality:  options.QualityOr(75),
+		Lossless: options.IsLossless(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(encoded)
+	return err
+}
+
+func (c *webpCodec) DecodeAll(r io.Reader) (*codec.Animation, error) {
+	file, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Go webp decoders only read still images, ImageMagick composes the frames into a gif
+	coalesced, err := c.sandbox.Convert(
+		file,
+		"webp",
+		"gif",
+		func(fullOriginalFileName string, fullConvertedFileName string) error {
+			return c.sandbox.Run(
+				"convert",
+				magickPath("webp", fullOriginalFileName),
+				"-coalesce",
+				magickPath("gif", fullConvertedFileName),
+			)
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.NewGifCodec().DecodeAll(bytes.NewReader(coalesced))
+}
+
+func (c *webpCodec) EncodeAll(w io.Writer, animation *codec.Animation, options codec.EncodeOptions) error {
+	encoded, err := c.sandbox.InTempDir(func(dir string) (string, error) {
+		args := []string{"-loop", strconv.Itoa(animation.LoopCount)}
+
+		if options.IsLossless() {
+			args = append(args, "-lossless")
+		} else {
+			args = append(args, "-lossy", "-q", formatFloat(options.QualityOr(75)))
+		}
+
+		for i, frame := range animation.Frames {
+			frameFileName := filepath.Join(dir, fmt.Sprintf("frame-%05d.png", i))
+
+			if err := writePng(frameFileName, frame); err != nil {
+				return "", err
+			}
+
+			args = append(args, "-d", strconv.FormatInt(animation.Delays[i].Milliseconds(), 10), frameFileName)
+		}
+
+		fullConvertedFileName := filepath.Join(dir, "animation.webp")
+		args = append(args, "-o", fullConvertedFileName)
+
+		return fullConvertedFileName, c.sandbox.Run("img2webp", args...)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(encoded)
+	return err
+}
+
+func writePng(fileName string, img image.Image) error {
+	file, err := os.Create(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return png.Encode(file, img)
+}
+
+type avifCodec struct {
+	sandbox *Sandbox
+}
+
+func NewAvifCodec(sandbox *Sandbox) codec.Codec {
+	return &avifCodec{
+		sandbox,
+	}
+}
+
+func (c *avifCodec) Format() codec.Format {
+	return codec.Avif
+}
+
+func (c *avifCodec) Decode(r io.Reader) (image.Image, error) {
+	file, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// there is no avif decoder for Go available, ImageMagick turns the file into png first
+	decoded, err := c.sandbox.Convert(
+		file,
+		"avif",
+		"png",
+		func(fullOriginalFileName string, fullConvertedFileName string) error {
+			return c.sandbox.Run(
+				"convert",
+				magickPath("avif", fullOriginalFileName),
+				magickPath("png", fullConvertedFileName),
+			)
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return png.Decode(bytes.NewReader(decoded))
+}
+
+func (c *avifCodec) Encode(w io.Writer, img image.Image, options codec.EncodeOptions) error {
+	encoded, err := c.sandbox.ConvertImage(
+		img,
+		"avif",
+		func(fullOriginalFileName string, fullConvertedFileName string) error {
+			args := []string{magickPath("png", fullOriginalFileName)}
+
+			if options.Quality != nil {
+				args = append(args, "-quality", formatFloat(*options.Quality))
+			}
+
+			if options.Speed != nil {
+				args = append(args, "-define", "heic:speed="+strconv.Itoa(*options.Speed))
+			}
+
+			args = append(args, magickPath("avif", fullConvertedFileName))
+
+			return c.sandbox.Run("convert", args...)
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(encoded)
+	return err
+}
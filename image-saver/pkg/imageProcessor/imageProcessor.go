@@ -1,126 +1,248 @@
 package imageProcessor
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
-	"os"
+	"image-common/pkg/codec"
+	"image-common/pkg/imaging"
 	"os/exec"
-	"runtime"
-
-	"github.com/google/uuid"
+	"strconv"
 )
 
-var supportedFileTypes map[string]string = map[string]string{
-	"jpeg": "jpeg",
-	"jpg":  "jpg",
-	"png":  "png",
-	"webp": "webp",
-	"avif": "avif",
-}
-
 type ImageData struct {
-	Name string
-	File []byte
+	Format string
+	// Master is the un-watermarked copy kept next to a watermarked variant.
+	Master bool
+	File   []byte
 }
 
 type convert func(fullOriginalFileName string, fullConvertedFileName string) error
 
-type ImageProcessor struct{}
+// UnprocessableError marks files that can't be converted whatever the
+// attempt, unsupported formats and files the decoders reject.
+type UnprocessableError struct {
+	Err error
+}
+
+func (e *UnprocessableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnprocessableError) Unwrap() error {
+	return e.Err
+}
+
+// unprocessable leaves failures of the shell converters unmarked, a crashed
+// converter may well succeed on the next attempt.
+func unprocessable(err error) error {
+	var exitErr *exec.ExitError
+	var execErr *exec.Error
+
+	if errors.As(err, &exitErr) || errors.As(err, &execErr) {
+		return err
+	}
+
+	return &UnprocessableError{err}
+}
+
+type ConvertOptions struct {
+	EncodeOptions   codec.EncodeOptions
+	Animation       string
+	MaxWidth        int
+	MaxHeight       int
+	CropAspectRatio float64
+	FocalPoint      *imaging.FocalPoint
+}
+
+type ImageProcessor struct {
+	codecs    *codec.Registry
+	watermark *Watermark
+	config    ImageProcessorConfig
+}
 
-func NewImageProcessor() *ImageProcessor {
-	return &ImageProcessor{}
+func NewImageProcessor(codecs *codec.Registry, watermark *Watermark, config ImageProcessorConfig) *ImageProcessor {
+	return &ImageProcessor{
+		codecs,
+		watermark,
+		config,
+	}
 }
 
-func (ip *ImageProcessor) ConvertImage(file []byte, originalName string, name string, format string) (*ImageData, error) {
-	imgBuf := bytes.NewBuffer(file)
-	imgDecoded, _, err := image.Decode(imgBuf)
+// ConvertImage returns the variant to publish and, for watermarked formats,
+// the un-watermarked master next to it.
+func (ip *ImageProcessor) ConvertImage(
+	file []byte,
+	originalName string,
+	format string,
+	options ConvertOptions,
+) ([]ImageData, error) {
+	if err := ip.config.PixelLimits.Check(file); err != nil {
+		return nil, unprocessable(err)
+	}
+
+	decoder, err := ip.codecs.Decoder(codec.Extension(originalName))
+
+	if err != nil {
+		return nil, unprocessable(err)
+	}
+
+	encoder, err := ip.codecs.Encoder(format)
+
+	if err != nil {
+		return nil, unprocessable(err)
+	}
+
+	animationInfo, err := codec.ScanAnimation(decoder.Format(), file)
+
+	if err != nil {
+		return nil, unprocessable(err)
+	}
+
+	var animation *codec.Animation
+	var imgDecoded image.Image
+
+	// animations are only decoded whole once their size is known to be within the limits
+	if ip.shouldPreserveAnimation(animationInfo, decoder, encoder, options) {
+		animation, err = decoder.(codec.AnimatedCodec).DecodeAll(bytes.NewReader(file))
+	} else {
+		imgDecoded, err = decoder.Decode(bytes.NewReader(file))
+	}
+
+	if err != nil {
+		return nil, unprocessable(err)
+	}
+
+	if animation != nil && options.CropAspectRatio > 0 && options.FocalPoint == nil {
+		// frames share one crop, searching every frame separately would make the picture jump
+		options.FocalPoint = imaging.SmartFocalPoint(animation.Frames[0], options.CropAspectRatio)
+	}
+
+	encodeOptions := codec.OptionsForFormat(ip.config.EncodeOptions, format).Merge(options.EncodeOptions)
+	isWatermarked := ip.watermark.AppliesTo(format)
+
+	encoded, err := ip.encode(encoder, imgDecoded, animation, options, encodeOptions, isWatermarked)
 
 	if err != nil {
 		return nil, err
 	}
 
+	images := []ImageData{{
+		Format: format,
+		File:   encoded,
+	}}
+
+	if isWatermarked {
+		master, err := ip.encode(encoder, imgDecoded, animation, options, encodeOptions, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, ImageData{
+			Format: format,
+			Master: true,
+			File:   master,
+		})
+	}
+
+	return images, nil
+}
+
+func (ip *ImageProcessor) encode(
+	encoder codec.Codec,
+	img image.Image,
+	animation *codec.Animation,
+	options ConvertOptions,
+	encodeOptions codec.EncodeOptions,
+	isWatermarked bool,
+) ([]byte, error) {
 	var encodedBuf bytes.Buffer
-	w := bufio.NewWriter(&encodedBuf)
-	var convertedFile []byte
-
-	switch format {
-	case "jpg", "jpeg":
-		err = jpeg.Encode(w, imgDecoded, nil)
-	case "png":
-		err = png.Encode(w, imgDecoded)
-	case "webp":
-		convertedFile, err = convertInShell(
-			file,
-			originalName,
-			"webp",
-			func(fullOriginalFileName string, fullConvertedFileName string) error {
-				cmd := exec.Command("cwebp", fullOriginalFileName, "-o", fullConvertedFileName)
-				_, err := cmd.Output()
-				return err
-			},
-		)
-	case "avif":
-		convertedFile, err = convertInShell(
-			file,
-			originalName,
-			"avif",
-			func(fullOriginalFileName string, fullConvertedFileName string) error {
-				cmd := exec.Command("convert", fullOriginalFileName, fullConvertedFileName)
-				_, err := cmd.Output()
-				return err
-			},
+	var err error
+
+	if animation != nil {
+		frames := make([]image.Image, len(animation.Frames))
+
+		for i, frame := range animation.Frames {
+			frames[i] = ip.transform(frame, options, isWatermarked)
+		}
+
+		err = encoder.(codec.AnimatedCodec).EncodeAll(
+			&encodedBuf,
+			&codec.Animation{Frames: frames, Delays: animation.Delays, LoopCount: animation.LoopCount},
+			encodeOptions,
 		)
-	default:
-		err = errors.New(fmt.Sprintf("Формат %s не поддерживается", format))
+	} else {
+		err = encoder.Encode(&encodedBuf, ip.transform(img, options, isWatermarked), encodeOptions)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	if len(convertedFile) == 0 {
-		convertedFile = encodedBuf.Bytes()
-	}
-
-	return &ImageData{
-			Name: name + "." + format,
-			File: convertedFile,
-		},
-		nil
+	return encodedBuf.Bytes(), nil
 }
 
-func convertInShell(file []byte, originalName string, convertFormat string, convertFn convert) ([]byte, error) {
-	if runtime.GOOS != "linux" {
-		return []byte{}, errors.New("Runtime OS isn't Linux - webp and avif conversion is not supported")
+// shouldPreserveAnimation decides before anything is decoded, the other
+// animations are replaced by their first frame.
+func (ip *ImageProcessor) shouldPreserveAnimation(
+	info codec.AnimationInfo,
+	decoder codec.Codec,
+	encoder codec.Codec,
+	options ConvertOptions,
+) bool {
+	mode := options.Animation
+
+	if mode == "" {
+		mode = ip.config.AnimationMode
+	}
+
+	if !info.IsAnimated() || mode != codec.AnimationPreserve {
+		return false
 	}
 
-	fullOriginalFileName := fmt.Sprintf("/tmp/%w", originalName)
+	if _, ok := decoder.(codec.AnimatedCodec); !ok {
+		return false
+	}
 
-	if err := os.WriteFile(fullOriginalFileName, file, 0644); err != nil {
-		return []byte{}, err
+	if _, ok := encoder.(codec.AnimatedCodec); !ok {
+		return false
 	}
 
-	fullConvertedFileName := fmt.Sprintf("/tmp/%w.%w", uuid.New().String(), convertFormat)
+	exceeds := info.Frames > ip.config.MaxAnimationFrames ||
+		info.Duration > ip.config.MaxAnimationDuration ||
+		(ip.config.MaxAnimationMegapixels > 0 && info.Megapixels() > ip.config.MaxAnimationMegapixels)
 
-	err := convertFn(fullOriginalFileName, fullConvertedFileName)
+	if exceeds {
+		fmt.Println(fmt.Sprintf(
+			"Animation with %d frames of %dx%d and %s duration exceeds the limits, saving a poster frame",
+			info.Frames,
+			info.Width,
+			info.Height,
+			info.Duration,
+		))
 
-	if err != nil {
-		return []byte{}, err
+		return false
 	}
 
-	convertedFile, err := os.ReadFile(fullConvertedFileName)
+	return true
+}
 
-	if err != nil {
-		return []byte{}, err
+func (ip *ImageProcessor) transform(img image.Image, options ConvertOptions, isWatermarked bool) image.Image {
+	if options.CropAspectRatio > 0 {
+		img = imaging.CropToAspect(img, options.CropAspectRatio, options.FocalPoint)
 	}
 
-	os.Remove(fullOriginalFileName)
-	os.Remove(fullConvertedFileName)
+	img = imaging.Fit(img, options.MaxWidth, options.MaxHeight)
+
+	if isWatermarked {
+		img = ip.watermark.Apply(img)
+	}
+
+	return img
+}
 
-	return convertedFile, nil
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
 }
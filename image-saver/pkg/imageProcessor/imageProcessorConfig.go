@@ -0,0 +1,245 @@
+package imageProcessor
+
+import (
+	"image-common/pkg/codec"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ImageProcessorConfig struct {
+	WebpEncoder            string
+	EncodeOptions          map[string]codec.EncodeOptions
+	AnimationMode          string
+	MaxAnimationFrames     int
+	MaxAnimationDuration   time.Duration
+	MaxAnimationMegapixels float64
+	Watermark              WatermarkConfig
+	Sandbox                SandboxConfig
+	PixelLimits            codec.PixelLimits
+}
+
+type WatermarkConfig struct {
+	Image    string
+	Text     string
+	Position string
+	Opacity  float64
+	Scale    float64
+	Formats  []string
+}
+
+func GetImageProcessorConfig() ImageProcessorConfig {
+	encodeOptions := map[string]codec.EncodeOptions{
+		codec.Jpeg.Name: {
+			Quality:     getFloatEnv("JpegQuality"),
+			Progressive: getBoolEnv("JpegProgressive"),
+		},
+		codec.Png.Name: {
+			CompressionLevel: getStringEnv("PngCompressionLevel"),
+		},
+		codec.Webp.Name: {
+			Quality:  getFloatEnv("WebpQuality"),
+			Lossless: getBoolEnv("WebpLossless"),
+		},
+		codec.Avif.Name: {
+			Quality: getFloatEnv("AvifQuality"),
+			Speed:   getIntEnv("AvifSpeed"),
+		},
+	}
+
+	for format, options := range encodeOptions {
+		if err := options.Validate(); err != nil {
+			panic(format + ": " + err.Error())
+		}
+	}
+
+	animationMode := getEnvOrDefault("AnimationMode", codec.AnimationPreserve)
+
+	if animationMode != codec.AnimationPreserve && animationMode != codec.AnimationPoster {
+		panic("Unknown animation mode " + animationMode)
+	}
+
+	maxAnimationFrames, err := strconv.Atoi(getEnvOrDefault("MaxAnimationFrames", "500"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	maxAnimationDuration, err := time.ParseDuration(getEnvOrDefault("MaxAnimationDuration", "60s"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	maxAnimationMegapixels, err := strconv.ParseFloat(getEnvOrDefault("MaxAnimationMegapixels", "200"), 64)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return ImageProcessorConfig{
+		getEnvOrDefault("WebpEncoder", WebpEncoderNative),
+		encodeOptions,
+		animationMode,
+		maxAnimationFrames,
+		maxAnimationDuration,
+		maxAnimationMegapixels,
+		getWatermarkConfig(),
+		getSandboxConfig(),
+		getPixelLimits(),
+	}
+}
+
+func getWatermarkConfig() WatermarkConfig {
+	opacity, err := strconv.ParseFloat(getEnvOrDefault("WatermarkOpacity", "0.5"), 64)
+
+	if err != nil || opacity < 0 || opacity > 1 {
+		panic("WatermarkOpacity must be a number between 0 and 1")
+	}
+
+	scale, err := strconv.ParseFloat(getEnvOrDefault("WatermarkScale", "0.2"), 64)
+
+	if err != nil || scale <= 0 || scale > 1 {
+		panic("WatermarkScale must be a number between 0 and 1")
+	}
+
+	formats := make([]string, 0)
+
+	for _, format := range strings.Split(os.Getenv("WatermarkFormats"), ",") {
+		if format = strings.TrimSpace(format); format != "" {
+			formats = append(formats, format)
+		}
+	}
+
+	return WatermarkConfig{
+		os.Getenv("WatermarkImage"),
+		os.Getenv("WatermarkText"),
+		getEnvOrDefault("WatermarkPosition", WatermarkBottomRight),
+		opacity,
+		scale,
+		formats,
+	}
+}
+
+// getSandboxConfig reads the limits of a single converter run, 0 disables a
+// limit. ConverterMaxMemory is in MiB.
+func getSandboxConfig() SandboxConfig {
+	timeout, err := time.ParseDuration(getEnvOrDefault("ConverterTimeout", "60s"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	maxMemory, err := strconv.ParseInt(getEnvOrDefault("ConverterMaxMemory", "2048"), 10, 64)
+
+	if err != nil || maxMemory < 0 {
+		panic("ConverterMaxMemory must be a non-negative integer")
+	}
+
+	maxCpuTime, err := time.ParseDuration(getEnvOrDefault("ConverterMaxCpuTime", "120s"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return SandboxConfig{
+		timeout,
+		maxMemory * 1024 * 1024,
+		maxCpuTime,
+		os.Getenv("ConverterTempDir"),
+	}
+}
+
+func getPixelLimits() codec.PixelLimits {
+	maxWidth, err := strconv.Atoi(getEnvOrDefault("MaxImageWidth", "20000"))
+
+	if err != nil || maxWidth < 0 {
+		panic("MaxImageWidth must be a non-negative integer")
+	}
+
+	maxHeight, err := strconv.Atoi(getEnvOrDefault("MaxImageHeight", "20000"))
+
+	if err != nil || maxHeight < 0 {
+		panic("MaxImageHeight must be a non-negative integer")
+	}
+
+	maxMegapixels, err := strconv.ParseFloat(getEnvOrDefault("MaxImageMegapixels", "100"), 64)
+
+	if err != nil || maxMegapixels < 0 {
+		panic("MaxImageMegapixels must be a non-negative number")
+	}
+
+	return codec.PixelLimits{
+		MaxWidth:      maxWidth,
+		MaxHeight:     maxHeight,
+		MaxMegapixels: maxMegapixels,
+	}
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+func getStringEnv(key string) *string {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func getFloatEnv(key string) *float32 {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 32)
+
+	if err != nil {
+		panic(err)
+	}
+
+	result := float32(parsed)
+	return &result
+}
+
+func getIntEnv(key string) *int {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &parsed
+}
+
+func getBoolEnv(key string) *bool {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return &parsed
+}
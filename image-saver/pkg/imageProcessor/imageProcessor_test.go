@@ -0,0 +1,70 @@
+package imageProcessor
+
+import (
+	"bytes"
+	"image"
+	"image-common/pkg/codec"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func newTestGif(t *testing.T, frames int, size int) []byte {
+	animation := &codec.Animation{}
+
+	for i := 0; i < frames; i++ {
+		frame := image.NewRGBA(image.Rect(0, 0, size, size))
+		frame.Set(i%size, 0, color.White)
+
+		animation.Frames = append(animation.Frames, frame)
+		animation.Delays = append(animation.Delays, 100*time.Millisecond)
+	}
+
+	var buf bytes.Buffer
+
+	if err := codec.NewGifCodec().EncodeAll(&buf, animation, codec.EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestConvertImageAnimationLimits(t *testing.T) {
+	config := ImageProcessorConfig{
+		AnimationMode:          codec.AnimationPreserve,
+		MaxAnimationFrames:     10,
+		MaxAnimationDuration:   500 * time.Millisecond,
+		MaxAnimationMegapixels: 0.01,
+	}
+
+	tests := []struct {
+		name   string
+		file   []byte
+		frames int
+	}{
+		{"WithinLimits", newTestGif(t, 5, 16), 5},
+		{"TooManyFrames", newTestGif(t, 11, 4), 1},
+		{"TooLong", newTestGif(t, 6, 4), 1},
+		{"TooManyPixels", newTestGif(t, 5, 64), 1},
+	}
+
+	ip := NewImageProcessor(codec.NewRegistry(codec.NewGifCodec()), nil, config)
+
+	for _, test := range tests {
+		images, err := ip.ConvertImage(test.file, "upload.gif", "gif", ConvertOptions{})
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		info, err := codec.ScanAnimation(codec.Gif, images[0].File)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Frames != test.frames {
+			t.Errorf("%s: expected %d frames, got %d", test.name, test.frames, info.Frames)
+		}
+	}
+}
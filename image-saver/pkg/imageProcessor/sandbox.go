@@ -0,0 +1,154 @@
+package imageProcessor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+type SandboxConfig struct {
+	Timeout    time.Duration
+	MaxMemory  int64
+	MaxCpuTime time.Duration
+	TempDir    string
+}
+
+// Sandbox runs the external converters: every run gets a deadline and the
+// memory and CPU limits, and works in a temp directory of its own that is
+// removed whatever the outcome.
+type Sandbox struct {
+	config  SandboxConfig
+	prlimit string
+}
+
+func NewSandbox(config SandboxConfig) (*Sandbox, error) {
+	sandbox := &Sandbox{config: config}
+
+	if runtime.GOOS != "linux" || (config.MaxMemory == 0 && config.MaxCpuTime == 0) {
+		return sandbox, nil
+	}
+
+	prlimit, err := exec.LookPath("prlimit")
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("prlimit is required for the converter limits: %s", err))
+	}
+
+	sandbox.prlimit = prlimit
+
+	return sandbox, nil
+}
+
+// Run kills the whole process group of the converter once the timeout has
+// passed, delegates ImageMagick starts included.
+func (s *Sandbox) Run(name string, args ...string) error {
+	ctx := context.Background()
+
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	if s.prlimit != "" {
+		cmd = exec.CommandContext(ctx, s.prlimit, append(s.limitArgs(), append([]string{"--", name}, args...)...)...)
+	}
+
+	setProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s: %w", name, s.config.Timeout, err)
+	}
+
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("%s: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return err
+}
+
+func (s *Sandbox) limitArgs() []string {
+	args := make([]string, 0, 2)
+
+	if s.config.MaxMemory > 0 {
+		args = append(args, "--as="+strconv.FormatInt(s.config.MaxMemory, 10))
+	}
+
+	if s.config.MaxCpuTime > 0 {
+		args = append(args, "--cpu="+strconv.Itoa(int(s.config.MaxCpuTime.Seconds())))
+	}
+
+	return args
+}
+
+// InTempDir passes a new directory to convertFn and returns the contents of
+// the file it names.
+func (s *Sandbox) InTempDir(convertFn func(dir string) (string, error)) ([]byte, error) {
+	if runtime.GOOS != "linux" {
+		return []byte{}, errors.New("Runtime OS isn't Linux - webp and avif conversion is not supported")
+	}
+
+	dir, err := os.MkdirTemp(s.config.TempDir, "image-saver-*")
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	fullConvertedFileName, err := convertFn(dir)
+
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return os.ReadFile(fullConvertedFileName)
+}
+
+// Convert writes file as the input of convertFn. The file names are fixed,
+// nothing of the uploaded file name reaches the command line.
+func (s *Sandbox) Convert(file []byte, inputFormat string, outputFormat string, convertFn convert) ([]byte, error) {
+	return s.InTempDir(func(dir string) (string, error) {
+		fullOriginalFileName := filepath.Join(dir, "input."+inputFormat)
+		fullConvertedFileName := filepath.Join(dir, "output."+outputFormat)
+
+		if err := os.WriteFile(fullOriginalFileName, file, 0600); err != nil {
+			return "", err
+		}
+
+		return fullConvertedFileName, convertFn(fullOriginalFileName, fullConvertedFileName)
+	})
+}
+
+func (s *Sandbox) ConvertImage(img image.Image, outputFormat string, convertFn convert) ([]byte, error) {
+	var pngBuf bytes.Buffer
+
+	if err := png.Encode(&pngBuf, img); err != nil {
+		return []byte{}, err
+	}
+
+	return s.Convert(pngBuf.Bytes(), "png", outputFormat, convertFn)
+}
+
+// magickPath prefixes the file with its coder, ImageMagick then neither
+// guesses the format from the contents nor reads anything else into the name.
+func magickPath(format string, fileName string) string {
+	return format + ":" + fileName
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package imageProcessor
+
+import "os/exec"
+
+// setProcessGroup leaves cmd alone, a timeout only kills the converter and
+// not its children.
+func setProcessGroup(cmd *exec.Cmd) {}
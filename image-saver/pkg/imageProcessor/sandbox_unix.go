@@ -0,0 +1,17 @@
+//go:build unix
+
+package imageProcessor
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup runs cmd in a process group of its own, so that a timeout
+// kills the children of the converter too.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
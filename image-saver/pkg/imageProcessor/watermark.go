@@ -0,0 +1,160 @@
+package imageProcessor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image-common/pkg/codec"
+	"image/color"
+	"os"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+)
+
+type Watermark struct {
+	mark     image.Image
+	position string
+	opacity  float64
+	scale    float64
+	formats  map[string]bool
+}
+
+func NewWatermark(config WatermarkConfig, codecs *codec.Registry) (*Watermark, error) {
+	if config.Image == "" && config.Text == "" {
+		return nil, nil
+	}
+
+	var mark image.Image
+	var err error
+
+	if config.Image != "" {
+		mark, err = loadWatermarkImage(config.Image, codecs)
+	} else {
+		mark = renderWatermarkText(config.Text)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Position {
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter:
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown watermark position %s", config.Position))
+	}
+
+	formats := make(map[string]bool)
+
+	for _, format := range config.Formats {
+		formats[strings.ToLower(format)] = true
+	}
+
+	return &Watermark{
+		mark,
+		config.Position,
+		config.Opacity,
+		config.Scale,
+		formats,
+	}, nil
+}
+
+func (w *Watermark) AppliesTo(format string) bool {
+	return w != nil && w.formats[strings.ToLower(format)]
+}
+
+func (w *Watermark) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	markWidth := int(float64(bounds.Dx()) * w.scale)
+	markHeight := markWidth * w.mark.Bounds().Dy() / w.mark.Bounds().Dx()
+
+	if markWidth < 1 || markHeight < 1 {
+		return img
+	}
+
+	mark := image.NewRGBA(image.Rect(0, 0, markWidth, markHeight))
+	draw.CatmullRom.Scale(mark, mark.Bounds(), w.mark, w.mark.Bounds(), draw.Src, nil)
+
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+
+	margin := min(bounds.Dx(), bounds.Dy()) / 50
+	markRect := mark.Bounds().Add(w.markOrigin(bounds, mark.Bounds().Size(), margin))
+	opacity := image.NewUniform(color.Alpha{uint8(w.opacity * 255)})
+
+	draw.DrawMask(result, markRect, mark, image.Point{}, opacity, image.Point{}, draw.Over)
+
+	return result
+}
+
+func (w *Watermark) markOrigin(bounds image.Rectangle, size image.Point, margin int) image.Point {
+	switch w.position {
+	case WatermarkTopLeft:
+		return image.Pt(bounds.Min.X+margin, bounds.Min.Y+margin)
+	case WatermarkTopRight:
+		return image.Pt(bounds.Max.X-size.X-margin, bounds.Min.Y+margin)
+	case WatermarkBottomLeft:
+		return image.Pt(bounds.Min.X+margin, bounds.Max.Y-size.Y-margin)
+	case WatermarkCenter:
+		return image.Pt(bounds.Min.X+(bounds.Dx()-size.X)/2, bounds.Min.Y+(bounds.Dy()-size.Y)/2)
+	default:
+		return image.Pt(bounds.Max.X-size.X-margin, bounds.Max.Y-size.Y-margin)
+	}
+}
+
+func loadWatermarkImage(fileName string, codecs *codec.Registry) (image.Image, error) {
+	decoder, err := codecs.Decoder(codec.Extension(fileName))
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return decoder.Decode(file)
+}
+
+// renderWatermarkText draws the text with the built-in bitmap font, the
+// result is scaled to the target image when applied.
+func renderWatermarkText(text string) image.Image {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil() + 2
+	height := face.Metrics().Height.Ceil() + 2
+
+	mark := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for _, layer := range []struct {
+		color  color.Color
+		offset int
+	}{
+		{color.Black, 1},
+		{color.White, 0},
+	} {
+		drawer := font.Drawer{
+			Dst:  mark,
+			Src:  image.NewUniform(layer.color),
+			Face: face,
+			Dot:  fixed.P(layer.offset, face.Metrics().Ascent.Ceil()+layer.offset),
+		}
+		drawer.DrawString(text)
+	}
+
+	return mark
+}
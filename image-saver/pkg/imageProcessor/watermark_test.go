@@ -0,0 +1,55 @@
+package imageProcessor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWatermarkPosition(t *testing.T) {
+	mark := image.NewRGBA(image.Rect(0, 0, 10, 5))
+
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 10; x++ {
+			mark.Set(x, y, color.White)
+		}
+	}
+
+	// a margin of 2 pixels, the mark is scaled to 20x10
+	bounds := image.Rect(0, 0, 100, 100)
+
+	tests := []struct {
+		position string
+		markRect image.Rectangle
+	}{
+		{WatermarkTopLeft, image.Rect(2, 2, 22, 12)},
+		{WatermarkTopRight, image.Rect(78, 2, 98, 12)},
+		{WatermarkBottomLeft, image.Rect(2, 88, 22, 98)},
+		{WatermarkBottomRight, image.Rect(78, 88, 98, 98)},
+		{WatermarkCenter, image.Rect(40, 45, 60, 55)},
+	}
+
+	for _, test := range tests {
+		w := &Watermark{mark: mark, position: test.position, opacity: 1, scale: 0.2}
+		marked := w.Apply(image.NewRGBA(bounds))
+
+		for y := 0; y < bounds.Dy(); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				r, _, _, _ := marked.At(x, y).RGBA()
+
+				if inMark := image.Pt(x, y).In(test.markRect); inMark != (r > 0) {
+					t.Fatalf("%s: expected the mark over %s only, pixel %d,%d differs", test.position, test.markRect, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestWatermarkSkipsTinyImages(t *testing.T) {
+	w := &Watermark{mark: image.NewRGBA(image.Rect(0, 0, 10, 5)), position: WatermarkCenter, opacity: 1, scale: 0.2}
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+
+	if marked := w.Apply(img); marked != image.Image(img) {
+		t.Error("expected an image too small for the mark to be left as it is")
+	}
+}
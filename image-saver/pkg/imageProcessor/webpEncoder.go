@@ -0,0 +1,60 @@
+package imageProcessor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+const (
+	WebpEncoderNative = "native"
+	WebpEncoderShell  = "shell"
+)
+
+type WebpOptions struct {
+	Quality  float32
+	Lossless bool
+}
+
+type Encoder interface {
+	Encode(img image.Image, options WebpOptions) ([]byte, error)
+}
+
+func NewWebpEncoder(config ImageProcessorConfig, sandbox *Sandbox) (Encoder, error) {
+	switch config.WebpEncoder {
+	case WebpEncoderNative:
+		return newNativeWebpEncoder(sandbox), nil
+	case WebpEncoderShell:
+		return NewShellWebpEncoder(sandbox), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown webp encoder %s", config.WebpEncoder))
+	}
+}
+
+type shellWebpEncoder struct {
+	sandbox *Sandbox
+}
+
+func NewShellWebpEncoder(sandbox *Sandbox) Encoder {
+	return &shellWebpEncoder{
+		sandbox,
+	}
+}
+
+func (e *shellWebpEncoder) Encode(img image.Image, options WebpOptions) ([]byte, error) {
+	return e.sandbox.ConvertImage(
+		img,
+		"webp",
+		func(fullOriginalFileName string, fullConvertedFileName string) error {
+			args := []string{"-q", formatFloat(options.Quality)}
+
+			if options.Lossless {
+				args = append(args, "-lossless")
+			}
+
+			args = append(args, fullOriginalFileName, "-o", fullConvertedFileName)
+
+			return e.sandbox.Run("cwebp", args...)
+		},
+	)
+}
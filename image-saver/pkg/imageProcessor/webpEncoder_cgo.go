@@ -0,0 +1,37 @@
+//go:build cgo
+
+package imageProcessor
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/chai2010/webp"
+)
+
+// The native encoder binds libwebp through cgo, builds with CGO_ENABLED=0
+// get the shell encoder instead.
+type nativeWebpEncoder struct{}
+
+func NewNativeWebpEncoder() Encoder {
+	return &nativeWebpEncoder{}
+}
+
+func newNativeWebpEncoder(sandbox *Sandbox) Encoder {
+	return NewNativeWebpEncoder()
+}
+
+func (e *nativeWebpEncoder) Encode(img image.Image, options WebpOptions) ([]byte, error) {
+	var encodedBuf bytes.Buffer
+
+	err := webp.Encode(&encodedBuf, img, &webp.Options{
+		Lossless: options.Lossless,
+		Quality:  options.Quality,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return encodedBuf.Bytes(), nil
+}
@@ -0,0 +1,17 @@
+//go:build cgo
+
+package imageProcessor
+
+import "testing"
+
+func TestNativeWebpEncoder(t *testing.T) {
+	testWebpEncoder(t, NewNativeWebpEncoder())
+}
+
+func BenchmarkNativeWebpEncoder(b *testing.B) {
+	benchmarkWebpEncoder(b, NewNativeWebpEncoder(), WebpOptions{Quality: 75})
+}
+
+func BenchmarkNativeWebpEncoderLossless(b *testing.B) {
+	benchmarkWebpEncoder(b, NewNativeWebpEncoder(), WebpOptions{Quality: 75, Lossless: true})
+}
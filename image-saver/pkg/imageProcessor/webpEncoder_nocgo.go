@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package imageProcessor
+
+import "fmt"
+
+func newNativeWebpEncoder(sandbox *Sandbox) Encoder {
+	fmt.Println("The native webp encoder requires cgo, falling back to cwebp")
+
+	return NewShellWebpEncoder(sandbox)
+}
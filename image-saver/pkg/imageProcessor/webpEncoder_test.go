@@ -0,0 +1,115 @@
+package imageProcessor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+func newBenchmarkImage(width int, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x % 256), uint8(y % 256), uint8((x + y) % 256), 255})
+		}
+	}
+
+	return img
+}
+
+func benchmarkWebpEncoder(b *testing.B, encoder Encoder, options WebpOptions) {
+	img := newBenchmarkImage(1024, 768)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := encoder.Encode(img, options); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// testWebpEncoder checks that the encoded images decode to the size of the
+// source, and to the same pixels when lossless.
+func testWebpEncoder(t *testing.T, encoder Encoder) {
+	img := newBenchmarkImage(64, 48)
+
+	tests := []struct {
+		name    string
+		options WebpOptions
+	}{
+		{"Lossy", WebpOptions{Quality: 75}},
+		{"Lossless", WebpOptions{Quality: 75, Lossless: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := encoder.Encode(img, test.options)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := webp.Decode(bytes.NewReader(encoded))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("expected the size %s, got %s", img.Bounds().Size(), decoded.Bounds().Size())
+			}
+
+			if !test.options.Lossless {
+				return
+			}
+
+			for y := 0; y < img.Bounds().Dy(); y++ {
+				for x := 0; x < img.Bounds().Dx(); x++ {
+					if !sameColor(decoded.At(x, y), img.At(x, y)) {
+						t.Fatalf("expected the pixel %d,%d to be %v, got %v", x, y, img.At(x, y), decoded.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func sameColor(a color.Color, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func newTestShellWebpEncoder(tb testing.TB) Encoder {
+	if _, err := exec.LookPath("cwebp"); err != nil {
+		tb.Skip("cwebp is not installed")
+	}
+
+	sandbox, err := NewSandbox(SandboxConfig{Timeout: time.Minute})
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return NewShellWebpEncoder(sandbox)
+}
+
+func TestShellWebpEncoder(t *testing.T) {
+	testWebpEncoder(t, newTestShellWebpEncoder(t))
+}
+
+func BenchmarkShellWebpEncoder(b *testing.B) {
+	benchmarkWebpEncoder(b, newTestShellWebpEncoder(b), WebpOptions{Quality: 75})
+}
+
+func BenchmarkShellWebpEncoderLossless(b *testing.B) {
+	benchmarkWebpEncoder(b, newTestShellWebpEncoder(b), WebpOptions{Quality: 75, Lossless: true})
+}
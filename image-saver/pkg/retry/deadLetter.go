@@ -0,0 +1,88 @@
+package retry
+
+import (
+	"image-common/pkg/transport"
+)
+
+// ListDeadLetters reads up to limit dead-lettered messages without removing
+// them, they are requeued in their original order once read.
+func ListDeadLetters(t transport.Transport, queueName string, limit int) ([]transport.Message, error) {
+	deliveries := make([]transport.Delivery, 0)
+
+	defer func() {
+		for i := len(deliveries) - 1; i >= 0; i-- {
+			deliveries[i].Reject(true)
+		}
+	}()
+
+	for len(deliveries) < limit {
+		delivery, ok, err := t.Get(DeadLetterQueueName(queueName))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	messages := make([]transport.Message, len(deliveries))
+
+	for i, delivery := range deliveries {
+		messages[i] = delivery.Message()
+	}
+
+	return messages, nil
+}
+
+// ReplayDeadLetters moves up to limit dead-lettered messages back to the work
+// queue with the failure headers cleared, so they get a full set of attempts.
+func ReplayDeadLetters(t transport.Transport, queueName string, limit int) (int, error) {
+	replayed := 0
+
+	for replayed < limit {
+		delivery, ok, err := t.Get(DeadLetterQueueName(queueName))
+
+		if err != nil {
+			return replayed, err
+		}
+
+		if !ok {
+			break
+		}
+
+		message := delivery.Message()
+		headers := make(map[string]interface{})
+
+		for key, value := range message.Headers {
+			switch key {
+			case HeaderAttempts, HeaderError, HeaderPermanent, HeaderFailedAt, HeaderOriginalQueue:
+			default:
+				headers[key] = value
+			}
+		}
+
+		err = t.Publish(queueName, transport.Message{
+			Body:    message.Body,
+			Headers: headers,
+		})
+
+		if err != nil {
+			delivery.Reject(true)
+			return replayed, err
+		}
+
+		err = delivery.Ack()
+
+		if err != nil {
+			return replayed, err
+		}
+
+		replayed++
+	}
+
+	return replayed, nil
+}
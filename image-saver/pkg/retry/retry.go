@@ -0,0 +1,145 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/transport"
+	"time"
+)
+
+const (
+	HeaderAttempts      = "x-attempts"
+	HeaderError         = "x-error"
+	HeaderPermanent     = "x-error-permanent"
+	HeaderFailedAt      = "x-failed-at"
+	HeaderOriginalQueue = "x-original-queue"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks failures that would fail the same way on every attempt,
+// such messages go straight to the dead-letter queue.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+func DelayQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queueName, delay)
+}
+
+func DeadLetterQueueName(queueName string) string {
+	return queueName + ".dead"
+}
+
+// DeclareTopology declares a delay queue for every retry delay and the
+// dead-letter queue. One delay queue per delay keeps a long delay from
+// holding back shorter ones behind it.
+func DeclareTopology(t transport.Transport, queueName string, config RetryConfig) error {
+	for _, delay := range config.Delays() {
+		err := t.DeclareQueue(DelayQueueName(queueName, delay), transport.QueueOptions{
+			Delay:       delay,
+			DelayTarget: queueName,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.DeclareQueue(DeadLetterQueueName(queueName), transport.QueueOptions{})
+}
+
+type Retrier struct {
+	transport transport.Transport
+	queueName string
+	delays    []time.Duration
+}
+
+func NewRetrier(t transport.Transport, queueName string, config RetryConfig) *Retrier {
+	return &Retrier{
+		t,
+		queueName,
+		config.Delays(),
+	}
+}
+
+// Fail settles a message that failed with err: it is republished to the next
+// delay queue, or to the dead-letter queue once it is permanent or out of
+// attempts, and then acknowledged. When republishing fails the message is
+// requeued as is so it isn't lost. The result tells whether the message was
+// dead-lettered.
+func (r *Retrier) Fail(delivery transport.Delivery, err error) (bool, error) {
+	message := delivery.Message()
+	attempts := Attempts(message) + 1
+	headers := make(map[string]interface{})
+
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+
+	headers[HeaderAttempts] = int32(attempts)
+
+	var queue string
+	deadLettered := IsPermanent(err) || attempts > len(r.delays)
+
+	if deadLettered {
+		queue = DeadLetterQueueName(r.queueName)
+		headers[HeaderError] = err.Error()
+		headers[HeaderPermanent] = IsPermanent(err)
+		headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+		headers[HeaderOriginalQueue] = r.queueName
+
+		fmt.Println(fmt.Sprintf("Message failed after %d attempts, moving it to %s: %s", attempts, queue, err))
+	} else {
+		delay := r.delays[attempts-1]
+		queue = DelayQueueName(r.queueName, delay)
+
+		fmt.Println(fmt.Sprintf("Attempt %d failed, retrying in %s: %s", attempts, delay, err))
+	}
+
+	publishErr := r.transport.Publish(queue, transport.Message{
+		Body:    message.Body,
+		Headers: headers,
+	})
+
+	if publishErr != nil {
+		// fails as well when the channel is gone, the broker then redelivers the message after the reconnect
+		delivery.Reject(true)
+		return false, publishErr
+	}
+
+	return deadLettered, delivery.Ack()
+}
+
+// Attempts is the number of failed attempts recorded on the message.
+func Attempts(message transport.Message) int {
+	switch value := message.Headers[HeaderAttempts].(type) {
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case int:
+		return value
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,62 @@
+package retry
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func GetRetryConfig() RetryConfig {
+	maxAttempts, err := strconv.Atoi(getEnvOrDefault("RetryMaxAttempts", "5"))
+
+	if err != nil || maxAttempts < 1 {
+		panic("RetryMaxAttempts must be a positive integer")
+	}
+
+	baseDelay, err := time.ParseDuration(getEnvOrDefault("RetryBaseDelay", "5s"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	maxDelay, err := time.ParseDuration(getEnvOrDefault("RetryMaxDelay", "10m"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return RetryConfig{
+		maxAttempts,
+		baseDelay,
+		maxDelay,
+	}
+}
+
+// Delays lists the wait before every retry, doubling from BaseDelay up to
+// MaxDelay. The first attempt isn't delayed, so there is one less than
+// MaxAttempts.
+func (c RetryConfig) Delays() []time.Duration {
+	delays := make([]time.Duration, 0, c.MaxAttempts-1)
+	delay := c.BaseDelay
+
+	for i := 1; i < c.MaxAttempts; i++ {
+		delays = append(delays, min(delay, c.MaxDelay))
+		delay *= 2
+	}
+
+	return delays
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
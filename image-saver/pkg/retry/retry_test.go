@@ -0,0 +1,107 @@
+package retry
+
+import (
+	"errors"
+	"image-common/pkg/transport"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelays(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   RetryConfig
+		expected []time.Duration
+	}{
+		{"SingleAttempt", RetryConfig{1, time.Second, time.Minute}, []time.Duration{}},
+		{"Doubling", RetryConfig{4, time.Second, time.Minute}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+		{"Capped", RetryConfig{5, time.Second, 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}},
+	}
+
+	for _, test := range tests {
+		if delays := test.config.Delays(); !reflect.DeepEqual(delays, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, delays)
+		}
+	}
+}
+
+// waitForMessage takes the next message of queue, the delay queues of the
+// memory transport republish in the background.
+func waitForMessage(t *testing.T, memory *transport.Memory, queue string) transport.Delivery {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		delivery, ok, err := memory.Get(queue)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			return delivery
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("expected a message in %s", queue)
+	return nil
+}
+
+func TestFailExhaustsAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		err         error
+		failures    int
+	}{
+		{"SingleAttempt", 1, errors.New("unavailable"), 1},
+		{"Retried", 3, errors.New("unavailable"), 3},
+		{"Permanent", 3, Permanent(errors.New("unreadable")), 1},
+	}
+
+	for _, test := range tests {
+		memory := transport.NewMemory()
+		config := RetryConfig{test.maxAttempts, time.Millisecond, time.Millisecond}
+
+		if err := DeclareTopology(memory, "jobs", config); err != nil {
+			t.Fatal(err)
+		}
+
+		retrier := NewRetrier(memory, "jobs", config)
+		memory.Publish("jobs", transport.Message{Body: []byte("job")})
+
+		for i := 1; i <= test.failures; i++ {
+			delivery := waitForMessage(t, memory, "jobs")
+
+			if attempts := Attempts(delivery.Message()); attempts != i-1 {
+				t.Errorf("%s: expected %d failed attempts recorded, got %d", test.name, i-1, attempts)
+			}
+
+			deadLettered, err := retrier.Fail(delivery, test.err)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if deadLettered != (i == test.failures) {
+				t.Errorf("%s: expected attempt %d to be dead-lettered %v", test.name, i, i == test.failures)
+			}
+		}
+
+		dead := waitForMessage(t, memory, DeadLetterQueueName("jobs"))
+		headers := dead.Message().Headers
+
+		if Attempts(dead.Message()) != test.failures || headers[HeaderPermanent] != IsPermanent(test.err) ||
+			headers[HeaderOriginalQueue] != "jobs" || headers[HeaderError] != test.err.Error() {
+			t.Errorf("%s: expected the failure to be recorded, got %v", test.name, headers)
+		}
+
+		if memory.Len("jobs") != 0 {
+			t.Errorf("%s: expected no message left to retry", test.name)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package storageAdapter
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/blob"
+	"strings"
+	"time"
+)
+
+// Completed formats are recorded as empty objects under jobs/<jobId>/, after
+// the key prefix if there is one. They outlive the original so a redelivered
+// job can tell it is already done, until DeleteExpiredJobMarkers removes
+// them.
+func (s *StorageAdapter) CompletedFormats(jobId string) (map[string]bool, error) {
+	prefix := s.keys.JobMarkers(jobId)
+	completed := make(map[string]bool)
+
+	keys, err := s.store.List(prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		completed[strings.TrimPrefix(key, prefix)] = true
+	}
+
+	return completed, nil
+}
+
+func (s *StorageAdapter) MarkCompleted(jobId string, format string) error {
+	return s.store.Put(s.keys.JobMarker(jobId, format), []byte{})
+}
+
+func (s *StorageAdapter) DeleteJobMarkers(jobId string) error {
+	keys, err := s.store.List(s.keys.JobMarkers(jobId))
+
+	if err != nil {
+		return err
+	}
+
+	return s.deleteKeys(keys)
+}
+
+// DeleteExpiredJobMarkers deletes the markers older than maxAge, by then the
+// job won't be delivered again.
+func (s *StorageAdapter) DeleteExpiredJobMarkers(maxAge time.Duration) (int, error) {
+	keys, err := s.store.List(s.keys.JobMarkersRoot())
+
+	if err != nil {
+		return 0, err
+	}
+
+	expired := make([]string, 0)
+
+	for _, key := range keys {
+		modTime, err := s.store.ModTime(key)
+
+		if errors.Is(err, blob.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if time.Since(modTime) > maxAge {
+			expired = append(expired, key)
+		}
+	}
+
+	return len(expired), s.deleteKeys(expired)
+}
+
+// CleanJobMarkers deletes the expired markers every interval until done is
+// closed. Instances running it at the same time only repeat each other.
+func (s *StorageAdapter) CleanJobMarkers(maxAge time.Duration, interval time.Duration, done <-chan struct{}) {
+	for {
+		deleted, err := s.DeleteExpiredJobMarkers(maxAge)
+
+		if err != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the expired job markers", err))
+		} else if deleted > 0 {
+			fmt.Println(fmt.Sprintf("Deleted %d expired job markers", deleted))
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *StorageAdapter) deleteKeys(keys []string) error {
+	for _, key := range keys {
+		err := s.store.Delete(key)
+
+		if err != nil && !errors.Is(err, blob.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
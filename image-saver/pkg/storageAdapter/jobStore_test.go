@@ -0,0 +1,106 @@
+package storageAdapter
+
+import (
+	"image-common/pkg/blob"
+	"image-common/pkg/storageKeys"
+	"testing"
+	"time"
+)
+
+func newTestStorageAdapter(t *testing.T) (*StorageAdapter, *blob.Memory) {
+	keys, err := storageKeys.NewScheme(storageKeys.Config{Prefix: "images"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := blob.NewMemory()
+
+	return NewStorageAdapter(store, keys, nil), store
+}
+
+func TestDeleteJobMarkers(t *testing.T) {
+	s, _ := newTestStorageAdapter(t)
+
+	for _, jobId := range []string{"job", "job2"} {
+		for _, format := range []string{"webp", "avif"} {
+			if err := s.MarkCompleted(jobId, format); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := s.DeleteJobMarkers("job"); err != nil {
+		t.Fatal(err)
+	}
+
+	if completed, err := s.CompletedFormats("job"); err != nil || len(completed) != 0 {
+		t.Errorf("expected no completed formats, got %v, %v", completed, err)
+	}
+
+	// the ids share a prefix
+	if completed, err := s.CompletedFormats("job2"); err != nil || len(completed) != 2 {
+		t.Errorf("expected the markers of the other job to be kept, got %v, %v", completed, err)
+	}
+}
+
+// agedStore reports the modification times of ages instead of the ones of
+// the writes.
+type agedStore struct {
+	*blob.Memory
+	ages map[string]time.Duration
+}
+
+func (s agedStore) ModTime(key string) (time.Time, error) {
+	if _, err := s.Memory.ModTime(key); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(-s.ages[key]), nil
+}
+
+func TestDeleteExpiredJobMarkers(t *testing.T) {
+	keys, err := storageKeys.NewScheme(storageKeys.Config{Prefix: "images"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := agedStore{blob.NewMemory(), map[string]time.Duration{
+		"images/jobs/old/webp":    48 * time.Hour,
+		"images/jobs/recent/webp": time.Hour,
+		"images/id.webp":          48 * time.Hour,
+	}}
+	s := NewStorageAdapter(store, keys, nil)
+
+	for _, jobId := range []string{"old", "recent"} {
+		if err := s.MarkCompleted(jobId, "webp"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// not a marker, however old
+	if err := store.Put("images/id.webp", []byte("webp")); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := s.DeleteExpiredJobMarkers(24 * time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted marker, got %d", deleted)
+	}
+
+	stored, err := store.List("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 2 || stored[0] != "images/id.webp" || stored[1] != "images/jobs/recent/webp" {
+		t.Errorf("expected the recent marker and the variant to be kept, got %v", stored)
+	}
+}
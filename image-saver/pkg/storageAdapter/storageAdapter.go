@@ -0,0 +1,65 @@
+package storageAdapter
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/blob"
+	"image-common/pkg/envelope"
+	"image-common/pkg/storageKeys"
+	"image-saver/pkg/imageProcessor"
+)
+
+type StorageAdapter struct {
+	store blob.Store
+	keys  *storageKeys.Scheme
+	// keyring decrypts the originals image-service has encrypted, nil when
+	// they are stored in the clear
+	keyring *envelope.Keyring
+}
+
+func NewStorageAdapter(store blob.Store, keys *storageKeys.Scheme, keyring *envelope.Keyring) *StorageAdapter {
+	return &StorageAdapter{
+		store,
+		keys,
+		keyring,
+	}
+}
+
+func (s *StorageAdapter) GetFile(name string) ([]byte, error) {
+	file, err := s.store.Get(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Decrypt refuses the files of another version too
+	if s.keyring != nil {
+		return s.keyring.Decrypt(name, file)
+	}
+
+	if envelope.IsEncrypted(file) {
+		return nil, errors.New(fmt.Sprintf("%s is encrypted and EncryptionKeys is not set", name))
+	}
+
+	return file, nil
+}
+
+func (s *StorageAdapter) SaveImageFormat(image storageKeys.ImageRef, imageData imageProcessor.ImageData) error {
+	if err := s.keys.Check(image); err != nil {
+		return err
+	}
+
+	if imageData.Master {
+		return s.store.Put(s.keys.Master(image, imageData.Format), imageData.File)
+	}
+
+	return s.store.Put(s.keys.Variant(image, imageData.Format), imageData.File)
+}
+
+func (s *StorageAdapter) DeleteFile(name string) error {
+	return s.store.Delete(name)
+}
+
+func (s *StorageAdapter) IsNotFound(err error) bool {
+	return errors.Is(err, blob.ErrNotFound)
+}
@@ -0,0 +1,26 @@
+package storageAdapter
+
+import (
+	"os"
+	"time"
+)
+
+// GetJobMarkerMaxAge is how long the markers of a job are kept, 0 leaves them
+// to a bucket lifecycle rule.
+func GetJobMarkerMaxAge() time.Duration {
+	maxAge, err := time.ParseDuration(getEnvOrDefault("JobMarkerMaxAge", "72h"))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return maxAge
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
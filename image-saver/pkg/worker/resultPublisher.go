@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"image-common/pkg/contracts"
+	"image-common/pkg/transport"
+)
+
+// ResultPublisher reports finished jobs to image-service. Results are
+// informational, a failed publish is logged and doesn't fail the job.
+type ResultPublisher struct {
+	transport transport.Transport
+	queueName string
+}
+
+func NewResultPublisher(t transport.Transport, queueName string) *ResultPublisher {
+	return &ResultPublisher{
+		t,
+		contracts.ResultQueueName(queueName),
+	}
+}
+
+// Publish skips jobs without an id, image-service can't match them to an image.
+func (p *ResultPublisher) Publish(job *contracts.ConversionJob, status string, jobErr error) {
+	if job == nil || job.JobId == "" {
+		return
+	}
+
+	result := contracts.ConversionResult{
+		Version:  contracts.ConversionResultVersion,
+		JobId:    job.JobId,
+		SaveName: job.SaveName,
+		Status:   status,
+	}
+
+	if status == contracts.ResultCompleted {
+		result.Formats = job.SaveFormats
+	}
+
+	if jobErr != nil {
+		result.Error = jobErr.Error()
+	}
+
+	body, err := json.Marshal(result)
+
+	if err == nil {
+		err = p.transport.Publish(p.queueName, transport.Message{Body: body})
+	}
+
+	if err != nil {
+		fmt.Println(fmt.Sprintf("Failed to publish the result of job %s: %s", job.JobId, err))
+	}
+}
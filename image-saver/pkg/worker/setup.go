@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"image-common/pkg/contracts"
+	"image-common/pkg/transport"
+	"image-saver/pkg/imageProcessor"
+	"image-saver/pkg/retry"
+)
+
+var priorities = []string{contracts.PriorityInteractive, contracts.PriorityBulk}
+
+// LaneQueueNames lists the job queue of every priority.
+func LaneQueueNames(queueName string) []string {
+	names := make([]string, 0, len(priorities))
+
+	for _, priority := range priorities {
+		names = append(names, contracts.LaneQueueName(queueName, priority))
+	}
+
+	return names
+}
+
+// DeclareQueues declares the job queue of every priority with its retry
+// topology, and the results queue.
+func DeclareQueues(t transport.Transport, queueName string, retryConfig retry.RetryConfig) error {
+	err := t.DeclareQueue(contracts.ResultQueueName(queueName), transport.QueueOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range LaneQueueNames(queueName) {
+		err := t.DeclareQueue(name, transport.QueueOptions{})
+
+		if err != nil {
+			return err
+		}
+
+		err = retry.DeclareTopology(t, name, retryConfig)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewFromEnv builds a worker with the image processor and retry settings
+// read from the environment.
+func NewFromEnv(
+	storage Storage,
+	t transport.Transport,
+	queueName string,
+	retryConfig retry.RetryConfig,
+	config WorkerConfig,
+) (*Worker, error) {
+	imageProcessorConfig := imageProcessor.GetImageProcessorConfig()
+	codecs, err := imageProcessor.NewCodecRegistry(imageProcessorConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	watermark, err := imageProcessor.NewWatermark(imageProcessorConfig.Watermark, codecs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWorker(
+		imageProcessor.NewImageProcessor(codecs, watermark, imageProcessorConfig),
+		storage,
+		t,
+		queueName,
+		retryConfig,
+		config,
+	), nil
+}
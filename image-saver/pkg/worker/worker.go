@@ -0,0 +1,334 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image-common/pkg/codec"
+	"image-common/pkg/contracts"
+	"image-common/pkg/envelope"
+	"image-common/pkg/imaging"
+	"image-common/pkg/storageKeys"
+	"image-common/pkg/transport"
+	"image-saver/pkg/imageProcessor"
+	"image-saver/pkg/retry"
+	"sync"
+)
+
+// Storage is where originals are read from and conversions written to.
+type Storage interface {
+	GetFile(name string) ([]byte, error)
+	SaveImageFormat(image storageKeys.ImageRef, imageData imageProcessor.ImageData) error
+	DeleteFile(name string) error
+	IsNotFound(err error) bool
+	CompletedFormats(jobId string) (map[string]bool, error)
+	MarkCompleted(jobId string, format string) error
+	DeleteJobMarkers(jobId string) error
+}
+
+// lane is the queue of one job priority with the workers reserved for it.
+type lane struct {
+	queueName string
+	options   transport.ConsumeOptions
+	retrier   *retry.Retrier
+}
+
+type Worker struct {
+	imgProcessor *imageProcessor.ImageProcessor
+	storage      Storage
+	transport    transport.Transport
+	lanes        []lane
+	results      *ResultPublisher
+	config       WorkerConfig
+}
+
+func NewWorker(
+	imgProcessor *imageProcessor.ImageProcessor,
+	storage Storage,
+	t transport.Transport,
+	queueName string,
+	retryConfig retry.RetryConfig,
+	config WorkerConfig,
+) *Worker {
+	lanes := make([]lane, 0, 2)
+
+	for _, priority := range priorities {
+		laneQueueName := contracts.LaneQueueName(queueName, priority)
+		options := transport.ConsumeOptions{Concurrency: config.Workers, Prefetch: config.Prefetch}
+
+		if priority == contracts.PriorityBulk {
+			options = transport.ConsumeOptions{Concurrency: config.BulkWorkers, Prefetch: config.BulkPrefetch}
+		}
+
+		lanes = append(lanes, lane{
+			laneQueueName,
+			options,
+			retry.NewRetrier(t, laneQueueName, retryConfig),
+		})
+	}
+
+	return &Worker{
+		imgProcessor,
+		storage,
+		t,
+		lanes,
+		NewResultPublisher(t, queueName),
+		config,
+	}
+}
+
+// Consume handles the jobs of every lane with the workers reserved for it
+// until ctx is done and every job in progress is settled. A backlog of bulk
+// jobs then never delays interactive ones, and bulk jobs always progress.
+func (w *Worker) Consume(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(w.lanes))
+
+	for _, l := range w.lanes {
+		wg.Add(1)
+
+		go func(l lane) {
+			defer wg.Done()
+
+			errs <- w.transport.Consume(ctx, l.queueName, l.options, func(delivery transport.Delivery) {
+				w.handle(l.retrier, delivery)
+			})
+		}(l)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) handle(retrier *retry.Retrier, delivery transport.Delivery) {
+	body := delivery.Message().Body
+	fmt.Println("received a message:", string(body))
+
+	job, err := contracts.DecodeConversionJob(body)
+
+	var validationErr *contracts.ValidationError
+
+	if errors.As(err, &validationErr) {
+		err = retry.Permanent(err)
+	} else if err == nil {
+		err = w.process(job)
+	}
+
+	if err != nil {
+		deadLettered, failErr := retrier.Fail(delivery, err)
+
+		if failErr != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to schedule a retry", failErr))
+		} else if deadLettered {
+			w.results.Publish(job, contracts.ResultFailed, err)
+			w.deleteJobMarkers(job)
+		}
+	} else {
+		w.results.Publish(job, contracts.ResultCompleted, nil)
+		delivery.Ack()
+		fmt.Println("Image has been processed successfully")
+	}
+}
+
+func (w *Worker) process(data *contracts.ConversionJob) error {
+	var cropAspectRatio float64
+	var err error
+
+	if data.CropAspectRatio != "" {
+		cropAspectRatio, err = imaging.ParseAspectRatio(data.CropAspectRatio)
+
+		if err != nil {
+			return retry.Permanent(err)
+		}
+	}
+
+	formats, err := w.pendingFormats(data)
+
+	if err != nil {
+		return err
+	}
+
+	if len(formats) == 0 {
+		fmt.Println(fmt.Sprintf("Job %s has already been completed", data.JobId))
+		w.deleteOriginal(data)
+		return nil
+	}
+
+	originalImage, err := w.storage.GetFile(data.OriginalImageName)
+
+	if err != nil {
+		// decrypting again won't help, unlike configuring a missing key before a retry
+		if errors.Is(err, envelope.ErrCorrupted) {
+			return retry.Permanent(err)
+		}
+
+		if !w.storage.IsNotFound(err) {
+			return err
+		}
+
+		// another delivery of the job may have finished and deleted the original meanwhile
+		remaining, pendingErr := w.pendingFormats(data)
+
+		if pendingErr == nil && len(remaining) == 0 {
+			fmt.Println(fmt.Sprintf("Job %s has already been completed", data.JobId))
+			return nil
+		}
+
+		return retry.Permanent(err)
+	}
+
+	err = w.convertFormats(originalImage, data, formats, cropAspectRatio)
+
+	if err != nil {
+		var unprocessableErr *imageProcessor.UnprocessableError
+
+		// a job without the image date can't be stored under dated keys however often it is retried
+		if errors.As(err, &unprocessableErr) || errors.Is(err, storageKeys.ErrMissingDate) {
+			return retry.Permanent(err)
+		}
+
+		return err
+	}
+
+	w.deleteOriginal(data)
+
+	return nil
+}
+
+// pendingFormats leaves out the formats a previous delivery of the job has
+// produced. Jobs without an id can't be told apart and are always converted.
+func (w *Worker) pendingFormats(data *contracts.ConversionJob) ([]string, error) {
+	if data.JobId == "" {
+		return data.SaveFormats, nil
+	}
+
+	completed, err := w.storage.CompletedFormats(data.JobId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	formats := make([]string, 0, len(data.SaveFormats))
+
+	for _, format := range data.SaveFormats {
+		if !completed[format] {
+			formats = append(formats, format)
+		}
+	}
+
+	return formats, nil
+}
+
+func (w *Worker) deleteOriginal(data *contracts.ConversionJob) {
+	if data.KeepOriginal {
+		return
+	}
+
+	err := w.storage.DeleteFile(data.OriginalImageName)
+
+	if err != nil {
+		fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the original image file", err))
+	}
+}
+
+// deleteJobMarkers forgets the formats of a dead-lettered job, a replay
+// converts all of them again. The markers of completed jobs are kept for
+// redeliveries until they expire.
+func (w *Worker) deleteJobMarkers(data *contracts.ConversionJob) {
+	if data == nil || data.JobId == "" {
+		return
+	}
+
+	err := w.storage.DeleteJobMarkers(data.JobId)
+
+	if err != nil {
+		fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the job markers", err))
+	}
+}
+
+// convertFormats runs up to FormatConcurrency conversions of one message at
+// a time and returns the first error once all of them are done.
+func (w *Worker) convertFormats(
+	originalImage []byte,
+	data *contracts.ConversionJob,
+	formats []string,
+	cropAspectRatio float64,
+) error {
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	semaphore := make(chan struct{}, w.config.FormatConcurrency)
+
+	for _, format := range formats {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(format string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			err := w.convertFormat(originalImage, data, format, cropAspectRatio)
+
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(format)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+func (w *Worker) convertFormat(originalImage []byte, data *contracts.ConversionJob, format string, cropAspectRatio float64) error {
+	processedImages, err := w.imgProcessor.ConvertImage(
+		originalImage,
+		data.OriginalImageName,
+		format,
+		imageProcessor.ConvertOptions{
+			EncodeOptions:   codec.OptionsForFormat(data.EncodeOptions, format),
+			Animation:       data.Animation,
+			MaxWidth:        data.MaxWidth,
+			MaxHeight:       data.MaxHeight,
+			CropAspectRatio: cropAspectRatio,
+			FocalPoint:      data.FocalPoint,
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, processedImg := range processedImages {
+		if err := w.storage.SaveImageFormat(imageRefOf(data), processedImg); err != nil {
+			return err
+		}
+	}
+
+	if data.JobId == "" {
+		return nil
+	}
+
+	return w.storage.MarkCompleted(data.JobId, format)
+}
+
+// imageRefOf returns the image the job converts, jobs of image-service
+// versions before the key layouts have no creation date.
+func imageRefOf(data *contracts.ConversionJob) storageKeys.ImageRef {
+	imageRef := storageKeys.ImageRef{Id: data.SaveName}
+
+	if data.ImageCreatedDate != nil {
+		imageRef.CreatedDate = *data.ImageCreatedDate
+	}
+
+	return imageRef
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+type WorkerConfig struct {
+	Workers           int
+	BulkWorkers       int
+	Prefetch          int
+	BulkPrefetch      int
+	FormatConcurrency int
+	ShutdownTimeout   time.Duration
+}
+
+// GetWorkerConfig splits the CPUs between messages and the formats of a
+// single message, so that a busy pool keeps roughly one conversion per core.
+// BulkWorkers are a separate, smaller pool for bulk jobs on top of Workers.
+func GetWorkerConfig() WorkerConfig {
+	cpus := runtime.NumCPU()
+	workers := getPositiveIntEnv("Workers", max(1, cpus/2))
+	bulkWorkers := getPositiveIntEnv("BulkWorkers", max(1, workers/4))
+
+	return WorkerConfig{
+		workers,
+		bulkWorkers,
+		getPositiveIntEnv("Prefetch", workers),
+		getPositiveIntEnv("BulkPrefetch", bulkWorkers),
+		getPositiveIntEnv("FormatConcurrency", max(1, cpus/workers)),
+		getDurationEnv("ShutdownTimeout", 25*time.Second),
+	}
+}
+
+func getPositiveIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil || parsed < 1 {
+		panic(key + " must be a positive integer")
+	}
+
+	return parsed
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGetWorkerConfig(t *testing.T) {
+	cpus := runtime.NumCPU()
+	workers := max(1, cpus/2)
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected WorkerConfig
+	}{
+		{
+			"Defaults",
+			map[string]string{},
+			WorkerConfig{workers, max(1, workers/4), workers, max(1, workers/4), max(1, cpus/workers), 25 * time.Second},
+		},
+		{
+			"Workers",
+			map[string]string{"Workers": "8"},
+			WorkerConfig{8, 2, 8, 2, max(1, cpus/8), 25 * time.Second},
+		},
+		{
+			"Prefetch",
+			map[string]string{"Workers": "2", "Prefetch": "10", "BulkPrefetch": "3", "FormatConcurrency": "4"},
+			WorkerConfig{2, 1, 10, 3, 4, 25 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		for _, key := range []string{"Workers", "BulkWorkers", "Prefetch", "BulkPrefetch", "FormatConcurrency", "ShutdownTimeout"} {
+			t.Setenv(key, test.env[key])
+		}
+
+		if config := GetWorkerConfig(); config != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, config)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"bytes"
+	"image"
+	"image-common/pkg/codec"
+	"image-common/pkg/contracts"
+	"image-common/pkg/storageKeys"
+	"image-saver/pkg/imageProcessor"
+	"image/png"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrentStorage holds every save until limit of them run at the same
+// time, so that the conversions of a message have to overlap up to the limit.
+type concurrentStorage struct {
+	mu        sync.Mutex
+	limit     int
+	inFlight  int
+	maxFlight int
+	full      chan struct{}
+	completed map[string]bool
+}
+
+func newConcurrentStorage(limit int) *concurrentStorage {
+	return &concurrentStorage{limit: limit, full: make(chan struct{}), completed: make(map[string]bool)}
+}
+
+func (s *concurrentStorage) SaveImageFormat(image storageKeys.ImageRef, imageData imageProcessor.ImageData) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.maxFlight = max(s.maxFlight, s.inFlight)
+
+	if s.inFlight == s.limit {
+		close(s.full)
+	}
+
+	s.mu.Unlock()
+
+	select {
+	case <-s.full:
+	case <-time.After(5 * time.Second):
+	}
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *concurrentStorage) MarkCompleted(jobId string, format string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.completed[format] = true
+
+	return nil
+}
+
+func (s *concurrentStorage) GetFile(name string) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *concurrentStorage) DeleteFile(name string) error {
+	return nil
+}
+
+func (s *concurrentStorage) IsNotFound(err error) bool {
+	return false
+}
+
+func (s *concurrentStorage) CompletedFormats(jobId string) (map[string]bool, error) {
+	return nil, nil
+}
+
+func (s *concurrentStorage) DeleteJobMarkers(jobId string) error {
+	return nil
+}
+
+func TestConvertFormatsConcurrency(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	formats := []string{"png", "jpg", "gif"}
+	storage := newConcurrentStorage(2)
+	codecs := codec.NewRegistry(codec.NewPngCodec(), codec.NewJpegCodec(), codec.NewGifCodec())
+	w := &Worker{
+		imgProcessor: imageProcessor.NewImageProcessor(codecs, nil, imageProcessor.ImageProcessorConfig{}),
+		storage:      storage,
+		config:       WorkerConfig{FormatConcurrency: 2},
+	}
+	job := &contracts.ConversionJob{JobId: "job", OriginalImageName: "upload.png", SaveName: "id", SaveFormats: formats}
+
+	if err := w.convertFormats(buf.Bytes(), job, formats, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.maxFlight != 2 {
+		t.Errorf("expected 2 conversions at a time, got %d", storage.maxFlight)
+	}
+
+	if len(storage.completed) != len(formats) {
+		t.Errorf("expected %d completed formats, got %v", len(formats), storage.completed)
+	}
+}
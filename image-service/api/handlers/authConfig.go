@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"os"
+)
+
+type AuthConfig struct {
+	AdminApiKey string
+}
+
+func GetAuthConfig() AuthConfig {
+	return AuthConfig{
+		os.Getenv("AdminApiKey"),
+	}
+}
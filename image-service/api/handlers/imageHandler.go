@@ -3,43 +3,71 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"image-common/pkg/codec"
+	"image-common/pkg/imaging"
+	"image-common/pkg/storageKeys"
 	"image-service/pkg/core"
 	"net/http"
-	"path/filepath"
-	"strings"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/go-playground/validator/v10"
 )
 
-var validate *validator.Validate = validator.New(validator.WithRequiredStructEnabled())
+var validate *validator.Validate = newValidator()
 
-var extFileTypes map[string]string = map[string]string{
-	"jpeg": "image/jpeg",
-	"jpg":  "image/jpg",
-	"png":  "image/png",
-	"webp": "image/webp",
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	v.RegisterValidation("imageformat", func(fl validator.FieldLevel) bool {
+		format, prs := codec.FormatByExtension(fl.Field().String())
+		return prs && format.Capabilities.Encode
+	})
+
+	v.RegisterValidation("aspectratio", func(fl validator.FieldLevel) bool {
+		_, err := imaging.ParseAspectRatio(fl.Field().String())
+		return err == nil
+	})
+
+	return v
 }
 
-func GetImageFile(service core.ImageService) fiber.Handler {
+func GetImageFile(service core.ImageService, authConfig AuthConfig) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		fileName := c.Params("name")
-		extName := strings.ToLower(strings.Replace(filepath.Ext(fileName), ".", "", -1))
-		fmt.Println(extName)
+		format, prs := codec.FormatByExtension(codec.Extension(fileName))
 
-		if _, prs := extFileTypes[extName]; !prs {
+		if !prs {
 			c.Status(http.StatusBadRequest)
 			return c.JSON(GetErrorResponse(errors.New("Invalid file extension")))
 		}
 
-		imageFile, err := service.GetImageFile(fileName)
+		// masters and originals are only reached through the master flag
+		if storageKeys.IsPrivateName(fileName) {
+			c.Status(http.StatusNotFound)
+			return c.JSON(GetErrorResponse(errors.New("File not found")))
+		}
+
+		var imageFile []byte
+		var err error
+
+		if c.QueryBool("master") {
+			if !isAdmin(c, authConfig) {
+				c.Status(http.StatusForbidden)
+				return c.JSON(GetErrorResponse(errors.New("Master files are only available to admins")))
+			}
+
+			imageFile, err = service.GetImageMasterFile(fileName)
+		} else {
+			imageFile, err = service.GetImageFile(fileName)
+		}
+
 		if err != nil {
 			c.Status(http.StatusInternalServerError)
 			return c.JSON(GetErrorResponse(err))
 		}
 
-		c.Set("Content-Type", extFileTypes[extName])
+		c.Set("Content-Type", format.MimeType)
 		return c.Send(imageFile)
 	}
 }
@@ -75,6 +103,13 @@ func AddImage(service core.ImageService) fiber.Handler {
 			)
 		}
 
+		encodeOptions, err := parseEncodeOptions(requestBody.EncodeOptions)
+
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(GetErrorResponse(err))
+		}
+
 		fileHeader, err := c.FormFile("image")
 
 		if err != nil {
@@ -82,6 +117,11 @@ func AddImage(service core.ImageService) fiber.Handler {
 			return c.JSON(GetErrorResponse(err))
 		}
 
+		if err := validateOriginalFormat(fileHeader.Filename); err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(GetErrorResponse(err))
+		}
+
 		file, err := formFileToBytes(fileHeader)
 
 		if err != nil {
@@ -99,12 +139,21 @@ func AddImage(service core.ImageService) fiber.Handler {
 			AvailableFormats: requestBody.AvailableFormats,
 			File:             *file,
 			OriginalName:     &fileHeader.Filename,
+			FocalPoint:       focalPoint(requestBody.FocalPointX, requestBody.FocalPointY),
+			Options: core.ConversionOptions{
+				EncodeOptions:   encodeOptions,
+				Animation:       requestBody.Animation,
+				MaxWidth:        requestBody.MaxWidth,
+				MaxHeight:       requestBody.MaxHeight,
+				CropAspectRatio: requestBody.CropAspectRatio,
+				Priority:        requestBody.Priority,
+			},
 		}
 
 		image, err := service.CreateImage(imageCreateDto, true)
 
 		if err != nil {
-			c.Status(http.StatusInternalServerError)
+			c.Status(saveErrorStatus(err))
 			return c.JSON(GetErrorResponse(err))
 		}
 
@@ -131,11 +180,23 @@ func UpdateImage(service core.ImageService) fiber.Handler {
 			)
 		}
 
+		encodeOptions, err := parseEncodeOptions(requestBody.EncodeOptions)
+
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(GetErrorResponse(err))
+		}
+
 		fileHeader, err := c.FormFile("image")
 		var file *[]byte
 		var filename *string
 
 		if fileHeader != nil {
+			if err := validateOriginalFormat(fileHeader.Filename); err != nil {
+				c.Status(http.StatusBadRequest)
+				return c.JSON(GetErrorResponse(err))
+			}
+
 			filename = &fileHeader.Filename
 
 			file, err = formFileToBytes(fileHeader)
@@ -151,12 +212,21 @@ func UpdateImage(service core.ImageService) fiber.Handler {
 			AvailableFormats: &requestBody.AvailableFormats,
 			File:             file,
 			OriginalName:     filename,
+			FocalPoint:       focalPoint(requestBody.FocalPointX, requestBody.FocalPointY),
+			Options: core.ConversionOptions{
+				EncodeOptions:   encodeOptions,
+				Animation:       requestBody.Animation,
+				MaxWidth:        requestBody.MaxWidth,
+				MaxHeight:       requestBody.MaxHeight,
+				CropAspectRatio: requestBody.CropAspectRatio,
+				Priority:        requestBody.Priority,
+			},
 		}
 
 		image, err := service.UpdateImage(c.Params("id"), imageUpdateDto, true)
 
 		if err != nil {
-			c.Status(http.StatusInternalServerError)
+			c.Status(saveErrorStatus(err))
 			return c.JSON(GetErrorResponse(err))
 		}
 
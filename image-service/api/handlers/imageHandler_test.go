@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"image-common/pkg/blob"
+	"image-common/pkg/codec"
+	"image-common/pkg/storageKeys"
+	"image-service/api/handlers"
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"image-service/pkg/memoryAdapter"
+	"image-service/pkg/storageAdapter"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const adminApiKey = "admin-key"
+
+func TestGetImageFile(t *testing.T) {
+	store := blob.NewMemory()
+	keys := storageKeys.Flat()
+	imageRef := conformance.NewImageRef()
+
+	store.Put(keys.Variant(imageRef, "png"), []byte("variant"))
+	store.Put(keys.Master(imageRef, "png"), []byte("master"))
+	store.Put(keys.Original(imageRef, "png"), []byte("original"))
+
+	service := core.NewImageService(
+		memoryAdapter.NewImageRepository(),
+		storageAdapter.NewStorageAdapter(store, keys, nil),
+		"http://localhost:3000",
+		codec.PixelLimits{},
+	)
+
+	app := fiber.New()
+	app.Get("/api/get-file/:name", handlers.GetImageFile(service, handlers.AuthConfig{AdminApiKey: adminApiKey}))
+
+	tests := []struct {
+		name   string
+		path   string
+		admin  bool
+		status int
+		body   string
+	}{
+		{"Variant", imageRef.Id + ".png", false, http.StatusOK, "variant"},
+		{"MasterName", imageRef.Id + "-master.png", false, http.StatusNotFound, ""},
+		{"OriginalName", imageRef.Id + "-original.png", false, http.StatusNotFound, ""},
+		{"OriginalNameAsAdmin", imageRef.Id + "-original.png?master=true", true, http.StatusNotFound, ""},
+		{"MasterWithoutKey", imageRef.Id + ".png?master=true", false, http.StatusForbidden, ""},
+		{"Master", imageRef.Id + ".png?master=true", true, http.StatusOK, "master"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/get-file/"+test.path, nil)
+
+		if test.admin {
+			req.Header.Set("X-Api-Key", adminApiKey)
+		}
+
+		res, err := app.Test(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+
+		if res.StatusCode != test.status {
+			t.Errorf("%s: expected the status %d, got %d: %s", test.name, test.status, res.StatusCode, body)
+		} else if test.body != "" && string(body) != test.body {
+			t.Errorf("%s: expected %q, got %q", test.name, test.body, body)
+		}
+	}
+}
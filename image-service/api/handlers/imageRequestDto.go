@@ -2,10 +2,26 @@ package handlers
 
 type ImageCreateRequestDto struct {
 	Name             *string  `json:"name,omitempty" validate:"omitempty"`
-	AvailableFormats []string `json:"availableFormats,omitempty" validate:"unique,dive,oneof=png jpg jpeg webp avif"`
+	AvailableFormats []string `json:"availableFormats,omitempty" validate:"unique,dive,imageformat"`
+	EncodeOptions    *string  `json:"encodeOptions,omitempty" validate:"omitempty,json"`
+	Animation        *string  `json:"animation,omitempty" validate:"omitempty,oneof=preserve poster"`
+	MaxWidth         *int     `json:"maxWidth,omitempty" validate:"omitempty,min=1,max=10000"`
+	MaxHeight        *int     `json:"maxHeight,omitempty" validate:"omitempty,min=1,max=10000"`
+	CropAspectRatio  *string  `json:"cropAspectRatio,omitempty" validate:"omitempty,aspectratio"`
+	FocalPointX      *float64 `json:"focalPointX,omitempty" validate:"required_with=FocalPointY,omitempty,min=0,max=1"`
+	FocalPointY      *float64 `json:"focalPointY,omitempty" validate:"required_with=FocalPointX,omitempty,min=0,max=1"`
+	Priority         *string  `json:"priority,omitempty" validate:"omitempty,oneof=interactive bulk"`
 }
 
 type ImageUpdateRequestDto struct {
 	Name             *string  `json:"name,omitempty" validate:"omitempty"`
-	AvailableFormats []string `json:"availableFormats,omitempty" validate:"omitempty,unique,dive,oneof=png jpg jpeg webp avif"`
+	AvailableFormats []string `json:"availableFormats,omitempty" validate:"omitempty,unique,dive,imageformat"`
+	EncodeOptions    *string  `json:"encodeOptions,omitempty" validate:"omitempty,json"`
+	Animation        *string  `json:"animation,omitempty" validate:"omitempty,oneof=preserve poster"`
+	MaxWidth         *int     `json:"maxWidth,omitempty" validate:"omitempty,min=1,max=10000"`
+	MaxHeight        *int     `json:"maxHeight,omitempty" validate:"omitempty,min=1,max=10000"`
+	CropAspectRatio  *string  `json:"cropAspectRatio,omitempty" validate:"omitempty,aspectratio"`
+	FocalPointX      *float64 `json:"focalPointX,omitempty" validate:"required_with=FocalPointY,omitempty,min=0,max=1"`
+	FocalPointY      *float64 `json:"focalPointY,omitempty" validate:"required_with=FocalPointX,omitempty,min=0,max=1"`
+	Priority         *string  `json:"priority,omitempty" validate:"omitempty,oneof=interactive bulk"`
 }
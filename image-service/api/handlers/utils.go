@@ -2,8 +2,15 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image-common/pkg/codec"
+	"image-common/pkg/imaging"
 	"io"
 	"mime/multipart"
+	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -33,3 +40,64 @@ func formFileToBytes(fileHeader *multipart.FileHeader) (*[]byte, error) {
 	bytes := buf.Bytes()
 	return &bytes, nil
 }
+
+func parseEncodeOptions(raw *string) (map[string]codec.EncodeOptions, error) {
+	encodeOptions := make(map[string]codec.EncodeOptions)
+
+	if raw == nil {
+		return encodeOptions, nil
+	}
+
+	if err := json.Unmarshal([]byte(*raw), &encodeOptions); err != nil {
+		return nil, err
+	}
+
+	for format, options := range encodeOptions {
+		if _, prs := codec.FormatByExtension(format); !prs {
+			return nil, errors.New(fmt.Sprintf("Unknown format %s in encode options", format))
+		}
+
+		if err := options.Validate(); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error in %s encode options: %s", format, err))
+		}
+	}
+
+	return encodeOptions, nil
+}
+
+func validateOriginalFormat(fileName string) error {
+	ext := codec.Extension(fileName)
+
+	if format, prs := codec.FormatByExtension(ext); !prs || !format.Capabilities.Decode {
+		return errors.New(fmt.Sprintf("Uploading of %s files is not supported", ext))
+	}
+
+	return nil
+}
+
+// saveErrorStatus tells images the service refuses to process from failures
+// of the service itself.
+func saveErrorStatus(err error) int {
+	var pixelLimitErr *codec.PixelLimitError
+
+	if errors.As(err, &pixelLimitErr) || errors.Is(err, codec.ErrUnknownSize) {
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+func isAdmin(c *fiber.Ctx, authConfig AuthConfig) bool {
+	apiKey := c.Get("X-Api-Key")
+
+	return authConfig.AdminApiKey != "" &&
+		subtle.ConstantTimeCompare([]byte(apiKey), []byte(authConfig.AdminApiKey)) == 1
+}
+
+func focalPoint(x *float64, y *float64) *imaging.FocalPoint {
+	if x == nil || y == nil {
+		return nil
+	}
+
+	return &imaging.FocalPoint{X: *x, Y: *y}
+}
@@ -7,9 +7,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func ImageRouter(app fiber.Router, service core.ImageService) {
+func ImageRouter(app fiber.Router, service core.ImageService, authConfig handlers.AuthConfig) {
 	app.Get("/image/:id", handlers.GetImage(service))
-	app.Get("/get-file/:name", handlers.GetImageFile(service))
+	app.Get("/get-file/:name", handlers.GetImageFile(service, authConfig))
 	app.Post("/image", handlers.AddImage(service))
 	app.Patch("/image/:id", handlers.UpdateImage(service))
 	app.Delete("/image/:id", handlers.DeleteImage(service))
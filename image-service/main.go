@@ -1,26 +1,28 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"image-service/api/routers"
+	"image-common/pkg/blob"
+	"image-common/pkg/envelope"
+	"image-common/pkg/rmq"
+	"image-common/pkg/storageConfig"
+	"image-common/pkg/storageKeys"
 	"image-service/pkg/core"
 	"image-service/pkg/dbAdapter"
-	"image-service/pkg/rmqAdapter"
-	"image-service/pkg/s3Adapter"
-	"image-service/pkg/utils"
+	"image-service/pkg/queueAdapter"
+	"image-service/pkg/server"
+	"image-service/pkg/storageAdapter"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
-	amqp "github.com/rabbitmq/amqp091-go"
-
-	_ "github.com/lib/pq"
 )
 
 func main() {
@@ -30,111 +32,282 @@ func main() {
 		panic(err)
 	}
 
-	db, err := databaseConnection()
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage" {
+		migrateStorageCommand(storageConfig.GetStorageConfig(), os.Args[2:])
+		return
+	}
+
+	db, err := dbAdapter.Connect(dbAdapter.GetPgDbConfig())
 
 	if err != nil {
 		panic(err)
 	}
 
-	imageRepository := dbAdapter.NewImageRepository(db)
+	defer db.Close()
 
-	s3Client, uploader, bucketName, err := s3Connection()
+	err = dbAdapter.Migrate(db)
 
 	if err != nil {
 		panic(err)
 	}
 
-	amqpConnection, rmqChannel, queue, err := rmqConnection()
+	store, err := blob.Open(storageConfig.GetStorageConfig())
+
 	if err != nil {
 		panic(err)
 	}
-	defer amqpConnection.Close()
-	defer rmqChannel.Close()
 
-	rmqAdapter := rmqAdapter.NewRmqAdapter(rmqChannel, queue)
-	s3Adapter := s3Adapter.NewS3Adapter(s3Client, uploader, bucketName, rmqAdapter)
-	imageService := core.NewImageService(imageRepository, s3Adapter, "http://localhost:3000")
+	keys, previousKeys := storageConfig.GetKeySchemes()
 
-	app := fiber.New()
+	if len(os.Args) > 1 && os.Args[1] == "migrate-keys" {
+		migrateKeysCommand(dbAdapter.NewImageRepository(db), store, keys, previousKeys, os.Args[2:])
+		return
+	}
 
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.SendString("Hello, World!")
-	})
+	keyring := storageConfig.GetKeyring()
 
-	api := app.Group("/api")
-	routers.ImageRouter(api, imageService)
+	if len(os.Args) > 1 && os.Args[1] == "rotate-encryption-keys" {
+		rotateEncryptionKeysCommand(store, keys, previousKeys, keyring)
+		return
+	}
 
-	app.Listen(":3000")
-}
+	var dataStorage core.DataStorage = storageAdapter.NewStorageAdapter(store, keys, previousKeys)
+
+	if keyring != nil {
+		dataStorage = storageAdapter.NewEncryptedStorage(dataStorage, keys, keyring)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "check-storage" {
+		checkStorageCommand(dbAdapter.NewImageRepository(db), store, dataStorage, keys, previousKeys, os.Args[2:])
+		return
+	}
+
+	rmqConfig := queueAdapter.GetRmqConfig()
+	rmqTransport, err := rmq.NewTransport(rmqConfig.RMQUrl)
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer rmqTransport.Close()
+
+	err = queueAdapter.DeclareQueues(rmqTransport, rmqConfig.RMQQueueName)
+
+	if err != nil {
+		panic(err)
+	}
 
-func databaseConnection() (*sql.DB, error) {
-	dbConfig := dbAdapter.GetPgDbConfig()
-	psqlconn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		dbConfig.Host,
-		dbConfig.Port,
-		dbConfig.User,
-		dbConfig.Password,
-		dbConfig.Dbname,
+	imageServer := server.NewServer(
+		db,
+		dataStorage,
+		queueAdapter.NewQueueAdapter(rmqTransport, rmqConfig.RMQQueueName),
+		server.GetServerConfig(),
 	)
 
-	fmt.Println(psqlconn)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	db, err := sql.Open("postgres", psqlconn)
+	err = imageServer.Run(ctx, ":3000", getShutdownTimeout())
 
 	if err != nil {
-		return nil, err
+		panic(err)
+	}
+}
+
+// migrateKeysCommand serves "migrate-keys [--dry-run]", it moves the files of
+// every image from the layout of the Previous* variables to the current one.
+func migrateKeysCommand(
+	repository core.ImageRepository,
+	store blob.Store,
+	keys *storageKeys.Scheme,
+	previousKeys *storageKeys.Scheme,
+	args []string,
+) {
+	dryRun := len(args) > 0 && args[0] == "--dry-run"
+
+	if previousKeys == nil || (len(args) > 0 && !dryRun) {
+		fmt.Println("usage: image-service migrate-keys [--dry-run], with PreviousStorageKeySharding and the other Previous* variables set")
+		os.Exit(2)
 	}
 
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	db.SetConnMaxIdleTime(5 * time.Minute)
+	var stats storageAdapter.KeyMigrationStats
+	afterId := ""
+
+	for {
+		images, err := repository.ListImages(afterId, 100)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if len(images) == 0 {
+			break
+		}
+
+		for _, image := range images {
+			if err := storageAdapter.MigrateImageKeys(store, previousKeys, keys, image, dryRun, &stats); err != nil {
+				panic(fmt.Sprintf("Failed to migrate the files of %s: %s", image.Id, err))
+			}
+		}
+
+		afterId = images[len(images)-1].Id
+
+		fmt.Println(fmt.Sprintf("Migrated up to %s: moved=%d skipped=%d missing=%d", afterId, stats.Moved, stats.Skipped, stats.Missing))
+	}
 
-	return db, nil
+	fmt.Println(fmt.Sprintf("Done (dry run: %v): moved=%d skipped=%d missing=%d", dryRun, stats.Moved, stats.Skipped, stats.Missing))
 }
 
-func s3Connection() (*s3.S3, *s3manager.Uploader, string, error) {
-	s3Config := s3Adapter.GetS3Config()
-
-	awsConfig := aws.NewConfig()
-	awsConfig.Endpoint = &s3Config.Endpoint
-	awsConfig.Region = aws.String("us-east-2")
-	awsConfig.S3ForcePathStyle = utils.BoolPointer(true)
-	awsConfig.Credentials = credentials.NewStaticCredentials(
-		s3Config.AccessKeyId,
-		s3Config.SecretAccessKey,
-		"",
-	)
+// migrateStorageCommand serves "migrate-storage [--checkpoint file]", it
+// copies the files of the storage to its secondaries. An interrupted run is
+// resumed from the checkpoint, which is removed once every file is copied.
+func migrateStorageCommand(config blob.Config, args []string) {
+	flags := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	checkpointFile := flags.String("checkpoint", "migrate-storage.checkpoint", "the file the last key copied is kept in")
+	flags.Parse(args)
+
+	if len(config.Secondaries) == 0 {
+		fmt.Println("usage: image-service migrate-storage [--checkpoint file], with Secondary1StorageBackend and the other Secondary1* variables set")
+		os.Exit(2)
+	}
+
+	source, err := blob.Open(blob.Config{Backend: config.Backend, Path: config.Path, S3: config.S3})
+
+	if err != nil {
+		panic(err)
+	}
+
+	destinations := make([]blob.Store, 0, len(config.Secondaries))
+
+	for _, secondaryConfig := range config.Secondaries {
+		destination, err := blob.Open(secondaryConfig)
 
-	sess := session.Must(session.NewSession(awsConfig))
-	uploader := s3manager.NewUploader(sess)
-	s3Client := s3.New(sess, awsConfig)
+		if err != nil {
+			panic(err)
+		}
 
-	return s3Client, uploader, s3Config.Bucket, nil
+		destinations = append(destinations, destination)
+	}
+
+	afterKey := ""
+	checkpoint, err := os.ReadFile(*checkpointFile)
+
+	if err == nil {
+		afterKey = strings.TrimSpace(string(checkpoint))
+		fmt.Println(fmt.Sprintf("Resuming after %s", afterKey))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		panic(err)
+	}
+
+	stats, err := storageAdapter.MigrateStorage(source, destinations, afterKey, func(key string, stats storageAdapter.StorageMigrationStats) error {
+		fmt.Println(fmt.Sprintf("Migrated up to %s: copied=%d verified=%d vanished=%d", key, stats.Copied, stats.Verified, stats.Vanished))
+
+		return os.WriteFile(*checkpointFile, []byte(key), 0644)
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.Remove(*checkpointFile); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(fmt.Sprintf("Done: copied=%d verified=%d vanished=%d", stats.Copied, stats.Verified, stats.Vanished))
 }
 
-func rmqConnection() (*amqp.Connection, *amqp.Channel, *amqp.Queue, error) {
-	rmqConfig := rmqAdapter.GetRmqConfig()
+// rotateEncryptionKeysCommand serves "rotate-encryption-keys", it encrypts
+// the stored originals again with the key of EncryptionKeyId.
+func rotateEncryptionKeysCommand(
+	store blob.Store,
+	keys *storageKeys.Scheme,
+	previousKeys *storageKeys.Scheme,
+	keyring *envelope.Keyring,
+) {
+	if keyring == nil {
+		fmt.Println("usage: image-service rotate-encryption-keys, with EncryptionKeys and EncryptionKeyId set")
+		os.Exit(2)
+	}
+
+	stats, err := storageAdapter.RotateEncryptionKeys(store, keys, previousKeys, keyring)
 
-	connectionRabbitMQ, err := amqp.Dial(rmqConfig.RMQUrl)
 	if err != nil {
-		return nil, nil, nil, err
+		panic(err)
 	}
 
-	rmqChannel, err := connectionRabbitMQ.Channel()
+	fmt.Println(fmt.Sprintf("Done: rewrapped=%d current=%d clear=%d vanished=%d", stats.Rewrapped, stats.Current, stats.Clear, stats.Vanished))
+}
+
+// checkStorageCommand serves "check-storage [--delete-orphans] [--reconvert]
+// [--min-age 1h]", it only reports without the flags. The reconversions are
+// queued through the outbox, which the running instances relay.
+func checkStorageCommand(
+	repository core.ImageRepository,
+	store blob.Store,
+	dataStorage core.DataStorage,
+	keys *storageKeys.Scheme,
+	previousKeys *storageKeys.Scheme,
+	args []string,
+) {
+	var options storageAdapter.ConsistencyOptions
+
+	flags := flag.NewFlagSet("check-storage", flag.ExitOnError)
+	flags.BoolVar(&options.DeleteOrphans, "delete-orphans", false, "delete the orphaned files and the leftover originals")
+	flags.BoolVar(&options.Reconvert, "reconvert", false, "queue bulk jobs for the missing variants")
+	flags.DurationVar(&options.MinAge, "min-age", time.Hour, "leave the files younger than this alone")
+	flags.Parse(args)
+
+	report, err := storageAdapter.CheckConsistency(repository, store, dataStorage, keys, previousKeys, options)
+
 	if err != nil {
-		return nil, nil, nil, err
+		panic(err)
 	}
 
-	queue, err := rmqChannel.QueueDeclare(
-		rmqConfig.RMQQueueName, // name
-		false,                  // durable
-		false,                  // delete when unused
-		false,                  // exclusive
-		false,                  // no-wait
-		nil,                    // arguments
-	)
+	for _, key := range report.Orphans {
+		fmt.Println(fmt.Sprintf("orphan %s", key))
+	}
+
+	for _, key := range report.LeftoverOriginals {
+		fmt.Println(fmt.Sprintf("leftover original %s", key))
+	}
+
+	for id, formats := range report.MissingVariants {
+		fmt.Println(fmt.Sprintf("missing variants %s: %s", id, strings.Join(formats, ",")))
+	}
+
+	for _, id := range report.Unrecoverable {
+		fmt.Println(fmt.Sprintf("unrecoverable %s", id))
+	}
+
+	for _, key := range report.UnknownKeys {
+		fmt.Println(fmt.Sprintf("unknown %s", key))
+	}
+
+	fmt.Println(fmt.Sprintf(
+		"orphans=%d leftoverOriginals=%d imagesMissingVariants=%d unrecoverable=%d unknown=%d recent=%d deleted=%d reconverted=%d",
+		len(report.Orphans),
+		len(report.LeftoverOriginals),
+		len(report.MissingVariants),
+		len(report.Unrecoverable),
+		len(report.UnknownKeys),
+		report.Recent,
+		report.Deleted,
+		report.Reconverted,
+	))
+}
+
+func getShutdownTimeout() time.Duration {
+	value := os.Getenv("ShutdownTimeout")
+
+	if value == "" {
+		return 25 * time.Second
+	}
+
+	timeout, err := time.ParseDuration(value)
+
+	if err != nil {
+		panic(err)
+	}
 
-	return connectionRabbitMQ, rmqChannel, &queue, nil
+	return timeout
 }
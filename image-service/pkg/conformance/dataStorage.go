@@ -0,0 +1,226 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image-common/pkg/blob"
+	"image-common/pkg/contracts"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/core"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunDataStorage checks the behaviour image service relies on from a
+// DataStorage. Every case works on names of its own, so storages backed by
+// a shared bucket or directory can be reused between cases.
+func RunDataStorage(t *testing.T, newStorage func(t *testing.T) core.DataStorage) {
+	t.Run("SaveImage", func(t *testing.T) {
+		s := newStorage(t)
+		imageRef := NewImageRef()
+		maxWidth := 16
+
+		err := s.SaveImage(NewPng(t, 32, 24), imageRef, []string{"png", "jpg"}, core.ConversionOptions{MaxWidth: &maxWidth})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupFiles(t, s, imageRef, "png", "jpg")
+
+		for _, format := range []string{"png", "jpg"} {
+			file, err := s.GetImageFile(imageRef, format)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(file))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.Width != 16 || config.Height != 12 {
+				t.Errorf("expected a 16x12 %s, got %dx%d", format, config.Width, config.Height)
+			}
+
+			if expected := map[string]string{"png": "png", "jpg": "jpeg"}[format]; decodedFormat != expected {
+				t.Errorf("expected the %s variant to be a %s file, got %s", format, expected, decodedFormat)
+			}
+		}
+	})
+
+	t.Run("SaveImageSkipsUnsupportedFormats", func(t *testing.T) {
+		s := newStorage(t)
+		imageRef := NewImageRef()
+
+		if err := s.SaveImage(NewPng(t, 8, 8), imageRef, []string{"png", "unknown"}, core.ConversionOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupFiles(t, s, imageRef, "png")
+
+		if _, err := s.GetImageFile(imageRef, "unknown"); err == nil {
+			t.Error("expected no file for an unsupported format")
+		}
+	})
+
+	t.Run("SaveImageAsync", func(t *testing.T) {
+		s := newStorage(t)
+		imageRef := NewImageRef()
+		file := NewPng(t, 8, 8)
+		priority := contracts.PriorityBulk
+
+		job, err := s.SaveImageAsync(file, "upload.png", imageRef, []string{"webp", "unknown"}, core.ConversionOptions{Priority: &priority})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() {
+			s.DeleteFile(job.OriginalImageName)
+		})
+
+		if job.JobId == "" || job.SaveName != imageRef.Id || job.Priority != priority || job.Version != contracts.ConversionJobVersion {
+			t.Errorf("expected a job for %s, got %+v", imageRef.Id, job)
+		}
+
+		if job.ImageCreatedDate == nil || !job.ImageCreatedDate.Equal(imageRef.CreatedDate) {
+			t.Errorf("expected the job to carry the creation date %s, got %v", imageRef.CreatedDate, job.ImageCreatedDate)
+		}
+
+		if len(job.SaveFormats) != 1 || job.SaveFormats[0] != "webp" {
+			t.Errorf("expected only webp to be converted, got %v", job.SaveFormats)
+		}
+
+		body, err := json.Marshal(job)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := contracts.DecodeConversionJob(body); err != nil {
+			t.Errorf("expected a valid job: %s", err)
+		}
+
+		original, err := s.GetFile(job.OriginalImageName)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(original, file) {
+			t.Error("expected the original to be stored as uploaded")
+		}
+	})
+
+	t.Run("GetMissingFile", func(t *testing.T) {
+		s := newStorage(t)
+
+		if _, err := s.GetImageFile(NewImageRef(), "png"); !errors.Is(err, blob.ErrNotFound) {
+			t.Errorf("expected a not found error, got %v", err)
+		}
+
+		if _, err := s.GetFile(uuid.New().String() + ".png"); !errors.Is(err, blob.ErrNotFound) {
+			t.Errorf("expected a not found error, got %v", err)
+		}
+	})
+
+	t.Run("GetMissingMasterFile", func(t *testing.T) {
+		s := newStorage(t)
+		imageRef := NewImageRef()
+
+		if err := s.SaveImage(NewPng(t, 8, 8), imageRef, []string{"png"}, core.ConversionOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupFiles(t, s, imageRef, "png")
+
+		if _, err := s.GetImageMasterFile(imageRef, "png"); !errors.Is(err, blob.ErrNotFound) {
+			t.Errorf("expected a not found error for a format without master, got %v", err)
+		}
+	})
+
+	t.Run("DeleteFile", func(t *testing.T) {
+		s := newStorage(t)
+
+		job, err := s.SaveImageAsync(NewPng(t, 8, 8), "upload.png", NewImageRef(), []string{"webp"}, core.ConversionOptions{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.DeleteFile(job.OriginalImageName); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.GetFile(job.OriginalImageName); err == nil {
+			t.Error("expected the file to be gone")
+		}
+
+		if err := s.DeleteFile(job.OriginalImageName); err != nil {
+			t.Errorf("expected deleting a missing file to succeed, got %s", err)
+		}
+	})
+
+	t.Run("DeleteImage", func(t *testing.T) {
+		s := newStorage(t)
+		imageRef := NewImageRef()
+
+		if err := s.SaveImage(NewPng(t, 8, 8), imageRef, []string{"png", "jpg"}, core.ConversionOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		// formats that were never converted are skipped
+		if err := s.DeleteImage(imageRef, []string{"png", "jpg", "webp"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, format := range []string{"png", "jpg"} {
+			if _, err := s.GetImageFile(imageRef, format); err == nil {
+				t.Errorf("expected the %s variant to be deleted", format)
+			}
+		}
+	})
+}
+
+// NewImageRef returns a new image created now, with the precision postgres
+// keeps.
+func NewImageRef() storageKeys.ImageRef {
+	return storageKeys.ImageRef{
+		Id:          uuid.New().String(),
+		CreatedDate: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+// NewPng returns a gradient png of the given size.
+func NewPng(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func cleanupFiles(t *testing.T, s core.DataStorage, imageRef storageKeys.ImageRef, formats ...string) {
+	t.Cleanup(func() {
+		s.DeleteImage(imageRef, formats)
+	})
+}
@@ -0,0 +1,370 @@
+package conformance
+
+import (
+	"errors"
+	"image-common/pkg/contracts"
+	"image-common/pkg/imaging"
+	"image-service/pkg/core"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunImageRepository checks the behaviour image service relies on from an
+// ImageRepository. newRepository is called once per case, repositories
+// backed by a shared database only need to keep the images of other cases.
+func RunImageRepository(t *testing.T, newRepository func(t *testing.T) core.ImageRepository) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		r := newRepository(t)
+		dto := newImageCreateDto()
+		dto.FocalPoint = &imaging.FocalPoint{X: 0.25, Y: 0.75}
+		// the storage keys may depend on the date image service sets
+		createdDate := time.Date(2023, 5, 17, 23, 59, 59, 999999000, time.UTC)
+		dto.CreatedDate = &createdDate
+
+		created, err := r.CreateImage(dto, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupImage(t, r, created.Id)
+
+		image, err := r.GetImageById(*dto.Id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Id != *dto.Id || image.Name != *dto.Name || image.Url != *dto.Url {
+			t.Errorf("expected the image of %+v, got %+v", dto, image)
+		}
+
+		if len(image.AvailableFormats) != 2 || image.AvailableFormats[0] != "png" || image.AvailableFormats[1] != "jpg" {
+			t.Errorf("expected the formats png and jpg, got %v", image.AvailableFormats)
+		}
+
+		if image.FocalPoint == nil || *image.FocalPoint != *dto.FocalPoint {
+			t.Errorf("expected the focal point %+v, got %+v", dto.FocalPoint, image.FocalPoint)
+		}
+
+		if !image.CreatedDate.Equal(createdDate) || image.UpdatedDate.IsZero() {
+			t.Errorf("expected the creation date %s to be kept, got %+v", createdDate, image)
+		}
+
+		if image.ConversionStatus != nil {
+			t.Errorf("expected no conversion status without a job, got %s", *image.ConversionStatus)
+		}
+	})
+
+	t.Run("GetMissingImage", func(t *testing.T) {
+		r := newRepository(t)
+
+		if image, err := r.GetImageById(uuid.New().String()); !errors.Is(err, core.ErrImageNotFound) {
+			t.Errorf("expected core.ErrImageNotFound, got %+v, %v", image, err)
+		}
+	})
+
+	t.Run("CreateWithJob", func(t *testing.T) {
+		r := newRepository(t)
+		job := newJob()
+
+		created, err := r.CreateImage(newImageCreateDto(), job)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupImage(t, r, created.Id)
+
+		expectStatus(t, r, created.Id, core.ConversionPending, nil)
+	})
+
+	t.Run("UpdateConversionStatus", func(t *testing.T) {
+		r := newRepository(t)
+		job := newJob()
+
+		created, err := r.CreateImage(newImageCreateDto(), job)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupImage(t, r, created.Id)
+
+		conversionError := "webp: encoder failed"
+		updated, err := r.UpdateConversionStatus(job.JobId, contracts.ResultFailed, &conversionError)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if updated != 1 {
+			t.Errorf("expected 1 updated image, got %d", updated)
+		}
+
+		expectStatus(t, r, created.Id, contracts.ResultFailed, &conversionError)
+
+		updated, err = r.UpdateConversionStatus(uuid.New().String(), contracts.ResultCompleted, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if updated != 0 {
+			t.Errorf("expected no image updated for an unknown job, got %d", updated)
+		}
+	})
+
+	t.Run("KeepSource", func(t *testing.T) {
+		r := newRepository(t)
+		dto := newImageCreateDto()
+		cropAspectRatio := "16:9"
+		maxWidth := 800
+		dto.Source = &core.ImageSource{
+			Name:    *dto.Id + "-original.png",
+			Options: core.ConversionOptions{CropAspectRatio: &cropAspectRatio, MaxWidth: &maxWidth},
+		}
+
+		created, err := r.CreateImage(dto, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupImage(t, r, created.Id)
+
+		image, err := r.GetImageById(created.Id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Source == nil || image.Source.Name != dto.Source.Name ||
+			image.Source.Options.CropAspectRatio == nil || *image.Source.Options.CropAspectRatio != cropAspectRatio ||
+			image.Source.Options.MaxWidth == nil || *image.Source.Options.MaxWidth != maxWidth {
+			t.Errorf("expected the source %+v, got %+v", dto.Source, image.Source)
+		}
+
+		image.Source = nil
+
+		if image, err = r.UpdateImage(*image, nil); err != nil || image.Source != nil {
+			t.Errorf("expected the source to be removed, got %+v, %v", image, err)
+		}
+	})
+
+	t.Run("UpdateWithNewJob", func(t *testing.T) {
+		r := newRepository(t)
+		oldJob := newJob()
+
+		created, err := r.CreateImage(newImageCreateDto(), oldJob)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupImage(t, r, created.Id)
+
+		conversionError := "failed"
+
+		if _, err := r.UpdateConversionStatus(oldJob.JobId, contracts.ResultFailed, &conversionError); err != nil {
+			t.Fatal(err)
+		}
+
+		created.Name = "renamed"
+		created.AvailableFormats = []string{"webp"}
+		created.UpdatedDate = time.Now()
+
+		image, err := r.UpdateImage(*created, newJob())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Name != "renamed" || len(image.AvailableFormats) != 1 || image.AvailableFormats[0] != "webp" {
+			t.Errorf("expected the image to be updated, got %+v", image)
+		}
+
+		expectStatus(t, r, created.Id, core.ConversionPending, nil)
+
+		// the result of the replaced job arrives late
+		updated, err := r.UpdateConversionStatus(oldJob.JobId, contracts.ResultCompleted, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if updated != 0 {
+			t.Errorf("expected the result of the replaced job to be ignored, got %d updated", updated)
+		}
+
+		expectStatus(t, r, created.Id, core.ConversionPending, nil)
+	})
+
+	t.Run("UpdateWithoutJob", func(t *testing.T) {
+		r := newRepository(t)
+		job := newJob()
+
+		created, err := r.CreateImage(newImageCreateDto(), job)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cleanupImage(t, r, created.Id)
+
+		conversionError := "failed"
+
+		if _, err := r.UpdateConversionStatus(job.JobId, contracts.ResultFailed, &conversionError); err != nil {
+			t.Fatal(err)
+		}
+
+		created.Name = "renamed"
+		created.FocalPoint = nil
+
+		if _, err := r.UpdateImage(*created, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		image, err := r.GetImageById(created.Id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if image.Name != "renamed" || image.FocalPoint != nil {
+			t.Errorf("expected the image to be renamed without a focal point, got %+v", image)
+		}
+
+		expectStatus(t, r, created.Id, contracts.ResultFailed, &conversionError)
+	})
+
+	t.Run("UpdateMissingImage", func(t *testing.T) {
+		r := newRepository(t)
+		image := core.ImageEntity{Id: uuid.New().String(), Name: "missing", UpdatedDate: time.Now()}
+
+		if updated, err := r.UpdateImage(image, nil); err == nil {
+			t.Errorf("expected an error, got %+v", updated)
+		}
+	})
+
+	t.Run("ListImages", func(t *testing.T) {
+		r := newRepository(t)
+		created := make(map[string]bool)
+
+		for i := 0; i < 3; i++ {
+			image, err := r.CreateImage(newImageCreateDto(), nil)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cleanupImage(t, r, image.Id)
+			created[image.Id] = true
+		}
+
+		afterId := ""
+
+		for {
+			images, err := r.ListImages(afterId, 2)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(images) > 2 {
+				t.Fatalf("expected at most 2 images, got %d", len(images))
+			}
+
+			if len(images) == 0 {
+				break
+			}
+
+			for _, image := range images {
+				if image.Id <= afterId {
+					t.Fatalf("expected the images after %s in id order, got %s", afterId, image.Id)
+				}
+
+				afterId = image.Id
+				delete(created, image.Id)
+			}
+		}
+
+		if len(created) != 0 {
+			t.Errorf("expected every image to be listed, missing %v", created)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		r := newRepository(t)
+
+		created, err := r.CreateImage(newImageCreateDto(), nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deleted, err := r.DeleteImageById(created.Id)
+
+		if err != nil || deleted != 1 {
+			t.Fatalf("expected 1 deleted image, got %d, %v", deleted, err)
+		}
+
+		if _, err := r.GetImageById(created.Id); err == nil {
+			t.Error("expected the image to be gone")
+		}
+
+		deleted, err = r.DeleteImageById(created.Id)
+
+		if err != nil || deleted != 0 {
+			t.Errorf("expected nothing deleted the second time, got %d, %v", deleted, err)
+		}
+	})
+}
+
+func newImageCreateDto() core.ImageCreateDto {
+	id := uuid.New().String()
+	name := "image " + id
+	url := "http://localhost:3000/api/get-file/" + id + ".png"
+
+	return core.ImageCreateDto{
+		Id:               &id,
+		Name:             &name,
+		Url:              &url,
+		AvailableFormats: []string{"png", "jpg"},
+	}
+}
+
+func newJob() *contracts.ConversionJob {
+	return &contracts.ConversionJob{
+		Version:     contracts.ConversionJobVersion,
+		JobId:       uuid.New().String(),
+		SaveFormats: []string{"png"},
+	}
+}
+
+func cleanupImage(t *testing.T, r core.ImageRepository, id string) {
+	t.Cleanup(func() {
+		r.DeleteImageById(id)
+	})
+}
+
+func expectStatus(t *testing.T, r core.ImageRepository, id string, status string, conversionError *string) {
+	t.Helper()
+
+	image, err := r.GetImageById(id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.ConversionStatus == nil || *image.ConversionStatus != status {
+		t.Errorf("expected the conversion status %s, got %v", status, image.ConversionStatus)
+	}
+
+	if (conversionError == nil) != (image.ConversionError == nil) ||
+		(conversionError != nil && *conversionError != *image.ConversionError) {
+		t.Errorf("expected the conversion error %v, got %v", conversionError, image.ConversionError)
+	}
+}
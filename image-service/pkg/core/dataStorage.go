@@ -1,9 +1,27 @@
 package core
 
+import (
+	"image-common/pkg/contracts"
+	"image-common/pkg/storageKeys"
+)
+
+// DataStorage keeps the files of the images, GetFile and DeleteFile take
+// the keys of the originals referenced by the conversion jobs. The errors
+// for missing files wrap blob.ErrNotFound.
 type DataStorage interface {
-	SaveImage(file []byte, name string, formats []string) error
-	SaveImageAsync(file []byte, originalImageName string, saveName string, formats []string) error
+	SaveImage(file []byte, image storageKeys.ImageRef, formats []string, options ConversionOptions) error
+	SaveImageAsync(
+		file []byte,
+		originalImageName string,
+		image storageKeys.ImageRef,
+		formats []string,
+		options ConversionOptions,
+	) (*contracts.ConversionJob, error)
+	GetImageFile(image storageKeys.ImageRef, format string) ([]byte, error)
+	GetImageMasterFile(image storageKeys.ImageRef, format string) ([]byte, error)
 	GetFile(name string) ([]byte, error)
 	DeleteFile(name string) error
-	DeleteImage(name string, formats []string) error
+	DeleteImage(image storageKeys.ImageRef, formats []string) error
+	// DatedKeys tells whether the keys of an image depend on its creation date.
+	DatedKeys() bool
 }
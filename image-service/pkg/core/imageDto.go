@@ -1,5 +1,11 @@
 package core
 
+import (
+	"image-common/pkg/codec"
+	"image-common/pkg/imaging"
+	"time"
+)
+
 type ImageCreateDto struct {
 	Id               *string
 	Name             *string
@@ -7,6 +13,10 @@ type ImageCreateDto struct {
 	AvailableFormats []string
 	File             []byte
 	OriginalName     *string
+	FocalPoint       *imaging.FocalPoint
+	Options          ConversionOptions
+	CreatedDate      *time.Time
+	Source           *ImageSource
 }
 
 type ImageUpdateDto struct {
@@ -15,4 +25,16 @@ type ImageUpdateDto struct {
 	AvailableFormats *[]string
 	File             *[]byte
 	OriginalName     *string
+	FocalPoint       *imaging.FocalPoint
+	Options          ConversionOptions
+}
+
+type ConversionOptions struct {
+	EncodeOptions   map[string]codec.EncodeOptions
+	Animation       *string
+	MaxWidth        *int
+	MaxHeight       *int
+	CropAspectRatio *string
+	FocalPoint      *imaging.FocalPoint
+	Priority        *string
 }
@@ -1,12 +1,31 @@
 package core
 
-import "time"
+import (
+	"image-common/pkg/imaging"
+	"time"
+)
 
 type ImageEntity struct {
-	Id               string    `json:"id"`
-	Name             string    `json:"name"`
-	Url              string    `json:"url"`
-	CreatedDate      time.Time `json:"createdDate"`
-	UpdatedDate      time.Time `json:"updatedDate"`
-	AvailableFormats []string  `json:"availableFormats"`
+	Id               string              `json:"id"`
+	Name             string              `json:"name"`
+	Url              string              `json:"url"`
+	CreatedDate      time.Time           `json:"createdDate"`
+	UpdatedDate      time.Time           `json:"updatedDate"`
+	AvailableFormats []string            `json:"availableFormats"`
+	FocalPoint       *imaging.FocalPoint `json:"focalPoint"`
+	ConversionStatus *string             `json:"conversionStatus,omitempty"`
+	ConversionError  *string             `json:"conversionError,omitempty"`
+	Source           *ImageSource        `json:"-"`
 }
+
+// ImageSource is the original kept for the images cropped to an aspect
+// ratio, with the options it was converted with, so that the variants can be
+// cropped again around a new focal point.
+type ImageSource struct {
+	Name    string
+	Options ConversionOptions
+}
+
+// ConversionPending is the status of an image until image-saver reports on
+// its job, the other statuses are the ones of the conversion results.
+const ConversionPending = "pending"
@@ -1,8 +1,20 @@
 package core
 
+import (
+	"errors"
+	"image-common/pkg/contracts"
+)
+
+// ErrImageNotFound is wrapped by the errors of GetImageById for ids without
+// an image, other errors don't tell whether it exists.
+var ErrImageNotFound = errors.New("Image not found")
+
 type ImageRepository interface {
 	GetImageById(id string) (*ImageEntity, error)
 	DeleteImageById(id string) (int, error)
-	CreateImage(image ImageCreateDto) (*ImageEntity, error)
-	UpdateImage(image ImageEntity) (*ImageEntity, error)
+	CreateImage(image ImageCreateDto, job *contracts.ConversionJob) (*ImageEntity, error)
+	UpdateImage(image ImageEntity, job *contracts.ConversionJob) (*ImageEntity, error)
+	UpdateConversionStatus(jobId string, status string, conversionError *string) (int, error)
+	// ListImages pages through the images by id, starting after afterId.
+	ListImages(afterId string, limit int) ([]ImageEntity, error)
 }
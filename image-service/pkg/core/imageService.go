@@ -3,6 +3,12 @@ package core
 import (
 	"errors"
 	"fmt"
+	"image-common/pkg/blob"
+	"image-common/pkg/codec"
+	"image-common/pkg/contracts"
+	"image-common/pkg/storageKeys"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,19 +20,23 @@ type ImageService interface {
 	CreateImage(image ImageCreateDto, isAsync bool) (*ImageEntity, error)
 	UpdateImage(id string, image ImageUpdateDto, isAsync bool) (*ImageEntity, error)
 	GetImageFile(name string) ([]byte, error)
+	GetImageMasterFile(name string) ([]byte, error)
+	HandleConversionResult(result contracts.ConversionResult) error
 }
 
 type imageService struct {
 	repository  ImageRepository
 	dataStorage DataStorage
 	appHost     string
+	pixelLimits codec.PixelLimits
 }
 
-func NewImageService(r ImageRepository, dataStorage DataStorage, appHost string) ImageService {
+func NewImageService(r ImageRepository, dataStorage DataStorage, appHost string, pixelLimits codec.PixelLimits) ImageService {
 	return &imageService{
 		repository:  r,
 		dataStorage: dataStorage,
 		appHost:     appHost,
+		pixelLimits: pixelLimits,
 	}
 }
 
@@ -35,7 +45,55 @@ func (s *imageService) GetImage(id string) (*ImageEntity, error) {
 }
 
 func (s *imageService) GetImageFile(name string) ([]byte, error) {
-	return s.dataStorage.GetFile(name)
+	imageRef, format, err := s.parseFileName(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.dataStorage.GetImageFile(imageRef, format)
+}
+
+// GetImageMasterFile falls back to the published variant for formats that
+// are not watermarked and so have no separate master. Other errors than a
+// missing master are returned, the variant is not a master to hand out.
+func (s *imageService) GetImageMasterFile(name string) ([]byte, error) {
+	imageRef, format, err := s.parseFileName(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.dataStorage.GetImageMasterFile(imageRef, format)
+
+	if errors.Is(err, blob.ErrNotFound) {
+		return s.dataStorage.GetImageFile(imageRef, format)
+	}
+
+	return file, err
+}
+
+// parseFileName reads "<id>.<format>", the creation date is only looked up
+// when the storage keys depend on it.
+func (s *imageService) parseFileName(name string) (storageKeys.ImageRef, string, error) {
+	ext := filepath.Ext(name)
+	imageRef := storageKeys.ImageRef{Id: strings.TrimSuffix(name, ext)}
+
+	if s.dataStorage.DatedKeys() {
+		image, err := s.repository.GetImageById(imageRef.Id)
+
+		if err != nil {
+			return imageRef, "", errors.New("Image not found")
+		}
+
+		imageRef.CreatedDate = image.CreatedDate
+	}
+
+	return imageRef, strings.TrimPrefix(ext, "."), nil
+}
+
+func imageRefOf(image *ImageEntity) storageKeys.ImageRef {
+	return storageKeys.ImageRef{Id: image.Id, CreatedDate: image.CreatedDate}
 }
 
 func (s *imageService) DeleteImage(id string) (int, error) {
@@ -45,39 +103,114 @@ func (s *imageService) DeleteImage(id string) (int, error) {
 		return 0, errors.New("Image not found")
 	}
 
-	err = s.dataStorage.DeleteImage(image.Id, image.AvailableFormats)
+	err = s.dataStorage.DeleteImage(imageRefOf(image), image.AvailableFormats)
 
 	if err != nil {
 		return 0, err
 	}
 
+	if image.Source != nil {
+		s.deleteFile(image.Source.Name)
+	}
+
 	return s.repository.DeleteImageById(image.Id)
 }
 
 func (s *imageService) CreateImage(imageDto ImageCreateDto, isAsync bool) (*ImageEntity, error) {
+	// nothing is decoded or stored before the declared size is known to be acceptable
+	if err := s.pixelLimits.Check(imageDto.File); err != nil {
+		return nil, err
+	}
+
 	uuid := uuid.New().String()
 	imageDto.Id = &uuid
 
+	// postgres keeps microseconds, a rounded date could fall on the next day
+	createdDate := time.Now().UTC().Truncate(time.Microsecond)
+	imageDto.CreatedDate = &createdDate
+	imageRef := storageKeys.ImageRef{Id: uuid, CreatedDate: createdDate}
+
 	if imageDto.Name == nil {
 		imageDto.Name = imageDto.Id
 	}
 
+	imageDto.Options.FocalPoint = imageDto.FocalPoint
+
+	var job *contracts.ConversionJob
 	var err error
 
 	if isAsync {
-		err = s.dataStorage.SaveImageAsync(imageDto.File, *imageDto.OriginalName, *imageDto.Id, imageDto.AvailableFormats)
+		job, err = s.dataStorage.SaveImageAsync(
+			imageDto.File,
+			*imageDto.OriginalName,
+			imageRef,
+			imageDto.AvailableFormats,
+			imageDto.Options,
+		)
 	} else {
-		err = s.dataStorage.SaveImage(imageDto.File, *imageDto.Id, imageDto.AvailableFormats)
+		err = s.dataStorage.SaveImage(imageDto.File, imageRef, imageDto.AvailableFormats, imageDto.Options)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	if imageDto.Options.CropAspectRatio != nil && job != nil {
+		imageDto.Source = keepSource(job, imageDto.Options)
+	} else if imageDto.Options.CropAspectRatio != nil {
+		imageDto.Source, err = s.storeSource(imageDto.File, *imageDto.OriginalName, imageRef, imageDto.Options)
+
+		if err != nil {
+			s.dataStorage.DeleteImage(imageRef, imageDto.AvailableFormats)
+			return nil, err
+		}
+	}
+
 	url := fmt.Sprintf("%s/api/get-file/%s.%s", s.appHost, *imageDto.Id, imageDto.AvailableFormats[0])
 	imageDto.Url = &url
 
-	return s.repository.CreateImage(imageDto)
+	// the job is written to the outbox with the row, so it is queued only if the row exists
+	image, err := s.repository.CreateImage(imageDto, job)
+
+	if err != nil {
+		if job != nil {
+			s.deleteOriginal(job)
+		} else {
+			s.dataStorage.DeleteImage(imageRef, imageDto.AvailableFormats)
+		}
+
+		if job == nil && imageDto.Source != nil {
+			s.deleteFile(imageDto.Source.Name)
+		}
+
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// keepSource keeps the original of an image cropped to an aspect ratio in
+// place once its job is done.
+func keepSource(job *contracts.ConversionJob, options ConversionOptions) *ImageSource {
+	job.KeepOriginal = true
+	return &ImageSource{job.OriginalImageName, options}
+}
+
+// storeSource stores the original of a sync upload like the async ones are,
+// without a job.
+func (s *imageService) storeSource(
+	file []byte,
+	originalName string,
+	image storageKeys.ImageRef,
+	options ConversionOptions,
+) (*ImageSource, error) {
+	stored, err := s.dataStorage.SaveImageAsync(file, originalName, image, nil, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageSource{stored.OriginalImageName, options}, nil
 }
 
 func (s *imageService) UpdateImage(id string, imageDto ImageUpdateDto, isAsync bool) (*ImageEntity, error) {
@@ -91,8 +224,21 @@ func (s *imageService) UpdateImage(id string, imageDto ImageUpdateDto, isAsync b
 		image.Name = *imageDto.Name
 	}
 
+	focalPointMoved := imageDto.FocalPoint != nil && (image.FocalPoint == nil || *image.FocalPoint != *imageDto.FocalPoint)
+
+	if imageDto.FocalPoint != nil {
+		image.FocalPoint = imageDto.FocalPoint
+	}
+
+	previousSource := image.Source
+	var job *contracts.ConversionJob
+
 	if imageDto.File != nil {
-		err = s.dataStorage.DeleteImage(image.Id, image.AvailableFormats)
+		if err := s.pixelLimits.Check(*imageDto.File); err != nil {
+			return nil, err
+		}
+
+		err = s.dataStorage.DeleteImage(imageRefOf(image), image.AvailableFormats)
 
 		if err != nil {
 			return nil, err
@@ -107,19 +253,108 @@ func (s *imageService) UpdateImage(id string, imageDto ImageUpdateDto, isAsync b
 		}
 
 		image.AvailableFormats = availableFormats
+		imageDto.Options.FocalPoint = image.FocalPoint
 
-		err = s.dataStorage.SaveImageAsync(*imageDto.File, *imageDto.OriginalName, image.Id, availableFormats)
+		job, err = s.dataStorage.SaveImageAsync(
+			*imageDto.File,
+			*imageDto.OriginalName,
+			imageRefOf(image),
+			availableFormats,
+			imageDto.Options,
+		)
 
 		if err != nil {
 			return nil, err
 		}
 
+		image.Source = nil
+
+		if imageDto.Options.CropAspectRatio != nil {
+			image.Source = keepSource(job, imageDto.Options)
+		}
+
 		url := fmt.Sprintf("%s/api/get-file/%s.%s", s.appHost, image.Id, image.AvailableFormats[0])
 		imageDto.Url = &url
+	} else if focalPointMoved && image.Source != nil {
+		job, err = s.cropAgain(image, imageDto.Options.Priority)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// image.UpdatedDate = time.Now().Format(time.RFC3339)
 	image.UpdatedDate = time.Now()
 
-	return s.repository.UpdateImage(*image)
+	updatedImage, err := s.repository.UpdateImage(*image, job)
+
+	if err != nil {
+		// the original of a new crop is the source the image still refers to
+		if job != nil && (previousSource == nil || previousSource.Name != job.OriginalImageName) {
+			s.deleteOriginal(job)
+		}
+
+		return nil, err
+	}
+
+	if previousSource != nil && (image.Source == nil || image.Source.Name != previousSource.Name) {
+		s.deleteFile(previousSource.Name)
+	}
+
+	return updatedImage, nil
+}
+
+// cropAgain converts the kept original of image with the options of its
+// upload around the focal point of image. The original is stored again, under
+// the current layout of the keys.
+func (s *imageService) cropAgain(image *ImageEntity, priority *string) (*contracts.ConversionJob, error) {
+	file, err := s.dataStorage.GetFile(image.Source.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	options := image.Source.Options
+	options.FocalPoint = image.FocalPoint
+	options.Priority = priority
+
+	job, err := s.dataStorage.SaveImageAsync(file, image.Source.Name, imageRefOf(image), image.AvailableFormats, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	image.Source = keepSource(job, options)
+
+	return job, nil
+}
+
+func (s *imageService) HandleConversionResult(result contracts.ConversionResult) error {
+	var conversionError *string
+
+	if result.Error != "" {
+		conversionError = &result.Error
+	}
+
+	updated, err := s.repository.UpdateConversionStatus(result.JobId, result.Status, conversionError)
+
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		fmt.Println(fmt.Sprintf("Job %s of %s has been replaced or deleted, ignoring its result", result.JobId, result.SaveName))
+	}
+
+	return nil
+}
+
+func (s *imageService) deleteOriginal(job *contracts.ConversionJob) {
+	s.deleteFile(job.OriginalImageName)
+}
+
+func (s *imageService) deleteFile(name string) {
+	if err := s.dataStorage.DeleteFile(name); err != nil {
+		fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the original image file", err))
+	}
 }
@@ -0,0 +1,361 @@
+package core_test
+
+import (
+	"bytes"
+	"errors"
+	"image-common/pkg/blob"
+	"image-common/pkg/codec"
+	"image-common/pkg/contracts"
+	"image-common/pkg/imaging"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"image-service/pkg/memoryAdapter"
+	"image-service/pkg/storageAdapter"
+	"testing"
+)
+
+const appHost = "http://localhost:3000"
+
+type service struct {
+	core.ImageService
+	repository *memoryAdapter.ImageRepository
+	store      *blob.Memory
+}
+
+func newService(pixelLimits codec.PixelLimits) *service {
+	repository := memoryAdapter.NewImageRepository()
+	store := blob.NewMemory()
+
+	return &service{
+		core.NewImageService(repository, storageAdapter.NewStorageAdapter(store, storageKeys.Flat(), nil), appHost, pixelLimits),
+		repository,
+		store,
+	}
+}
+
+func (s *service) files(t *testing.T) []string {
+	keys, err := s.store.List("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func newCreateDto(t *testing.T, formats ...string) core.ImageCreateDto {
+	originalName := "upload.png"
+
+	return core.ImageCreateDto{
+		AvailableFormats: formats,
+		File:             conformance.NewPng(t, 32, 24),
+		OriginalName:     &originalName,
+	}
+}
+
+func TestCreateImage(t *testing.T) {
+	s := newService(codec.PixelLimits{})
+
+	image, err := s.CreateImage(newCreateDto(t, "png", "jpg"), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.Name != image.Id || image.Url != appHost+"/api/get-file/"+image.Id+".png" {
+		t.Errorf("expected the name and url to be derived from the id, got %+v", image)
+	}
+
+	if image.ConversionStatus != nil || len(s.repository.Outbox()) != 0 {
+		t.Errorf("expected no conversion job, got %v", s.repository.Outbox())
+	}
+
+	for _, format := range []string{"png", "jpg"} {
+		if _, err := s.GetImageFile(image.Id + "." + format); err != nil {
+			t.Errorf("expected the %s to be saved: %s", format, err)
+		}
+	}
+}
+
+func TestCreateImageAsync(t *testing.T) {
+	s := newService(codec.PixelLimits{})
+
+	image, err := s.CreateImage(newCreateDto(t, "webp"), true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.ConversionStatus == nil || *image.ConversionStatus != core.ConversionPending {
+		t.Errorf("expected the conversion to be pending, got %v", image.ConversionStatus)
+	}
+
+	outbox := s.repository.Outbox()
+
+	if len(outbox) != 1 || outbox[0].SaveName != image.Id {
+		t.Fatalf("expected a job for %s in the outbox, got %+v", image.Id, outbox)
+	}
+
+	if _, err := s.store.Get(outbox[0].OriginalImageName); err != nil {
+		t.Errorf("expected the original to be stored: %s", err)
+	}
+
+	err = s.HandleConversionResult(contracts.ConversionResult{
+		Version:  contracts.ConversionResultVersion,
+		JobId:    outbox[0].JobId,
+		SaveName: image.Id,
+		Status:   contracts.ResultCompleted,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err = s.GetImage(image.Id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.ConversionStatus == nil || *image.ConversionStatus != contracts.ResultCompleted {
+		t.Errorf("expected the conversion to be completed, got %v", image.ConversionStatus)
+	}
+}
+
+func TestUpdateImageIgnoresResultsOfReplacedJobs(t *testing.T) {
+	s := newService(codec.PixelLimits{})
+
+	image, err := s.CreateImage(newCreateDto(t, "webp"), true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := conformance.NewPng(t, 16, 16)
+	originalName := "replacement.png"
+
+	if _, err := s.UpdateImage(image.Id, core.ImageUpdateDto{File: &file, OriginalName: &originalName}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	outbox := s.repository.Outbox()
+
+	if len(outbox) != 2 {
+		t.Fatalf("expected a second job, got %+v", outbox)
+	}
+
+	err = s.HandleConversionResult(contracts.ConversionResult{
+		Version:  contracts.ConversionResultVersion,
+		JobId:    outbox[0].JobId,
+		SaveName: image.Id,
+		Status:   contracts.ResultCompleted,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image, err = s.GetImage(image.Id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.ConversionStatus == nil || *image.ConversionStatus != core.ConversionPending {
+		t.Errorf("expected the conversion to stay pending, got %v", image.ConversionStatus)
+	}
+}
+
+func TestUpdateFocalPointCropsAgain(t *testing.T) {
+	for _, isAsync := range []bool{true, false} {
+		s := newService(codec.PixelLimits{})
+		dto := newCreateDto(t, "webp", "png")
+		cropAspectRatio := "1:1"
+		maxWidth := 16
+		dto.Options = core.ConversionOptions{CropAspectRatio: &cropAspectRatio, MaxWidth: &maxWidth}
+
+		image, err := s.CreateImage(dto, isAsync)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := s.GetImage(image.Id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.Source == nil {
+			t.Fatalf("async %v: expected the original of a cropped image to be kept", isAsync)
+		}
+
+		jobs := len(s.repository.Outbox())
+		focalPoint := imaging.FocalPoint{X: 0.9, Y: 0.1}
+
+		if _, err := s.UpdateImage(image.Id, core.ImageUpdateDto{FocalPoint: &focalPoint}, true); err != nil {
+			t.Fatal(err)
+		}
+
+		outbox := s.repository.Outbox()
+
+		if len(outbox) != jobs+1 {
+			t.Fatalf("async %v: expected a job for the new focal point, got %+v", isAsync, outbox)
+		}
+
+		job := outbox[len(outbox)-1]
+
+		if job.OriginalImageName != stored.Source.Name || !job.KeepOriginal || job.CropAspectRatio != cropAspectRatio ||
+			job.MaxWidth != maxWidth || job.FocalPoint == nil || *job.FocalPoint != focalPoint || len(job.SaveFormats) != 2 {
+			t.Errorf("async %v: expected the kept original to be cropped again with the options of the upload, got %+v", isAsync, job)
+		}
+
+		if _, err := s.UpdateImage(image.Id, core.ImageUpdateDto{FocalPoint: &focalPoint}, true); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(s.repository.Outbox()) != jobs+1 {
+			t.Errorf("async %v: expected no job when the focal point doesn't move", isAsync)
+		}
+
+		if _, err := s.DeleteImage(image.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		if files := s.files(t); len(files) != 0 {
+			t.Errorf("async %v: expected the kept original to be deleted with the image, got %v", isAsync, files)
+		}
+	}
+}
+
+func TestUpdateFocalPointWithoutCrop(t *testing.T) {
+	s := newService(codec.PixelLimits{})
+
+	image, err := s.CreateImage(newCreateDto(t, "webp"), true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	focalPoint := imaging.FocalPoint{X: 0.5, Y: 0.5}
+	updated, err := s.UpdateImage(image.Id, core.ImageUpdateDto{FocalPoint: &focalPoint}, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.FocalPoint == nil || *updated.FocalPoint != focalPoint || len(s.repository.Outbox()) != 1 {
+		t.Errorf("expected the focal point to be stored without a job, got %+v", updated)
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	s := newService(codec.PixelLimits{})
+
+	image, err := s.CreateImage(newCreateDto(t, "png", "jpg"), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := s.DeleteImage(image.Id)
+
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected 1 deleted image, got %d, %v", deleted, err)
+	}
+
+	if files := s.files(t); len(files) != 0 {
+		t.Errorf("expected the files to be deleted, got %v", files)
+	}
+
+	if _, err := s.DeleteImage(image.Id); err == nil {
+		t.Error("expected an error for a deleted image")
+	}
+}
+
+type unavailableMasterStorage struct {
+	core.DataStorage
+}
+
+func (s unavailableMasterStorage) GetImageMasterFile(image storageKeys.ImageRef, format string) ([]byte, error) {
+	return nil, errors.New("storage unavailable")
+}
+
+func TestGetImageMasterFileFallsBackToVariant(t *testing.T) {
+	s := newService(codec.PixelLimits{})
+
+	image, err := s.CreateImage(newCreateDto(t, "png"), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant, err := s.GetImageFile(image.Id + ".png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if master, err := s.GetImageMasterFile(image.Id + ".png"); err != nil || !bytes.Equal(master, variant) {
+		t.Errorf("expected the variant for a format without master: %v", err)
+	}
+
+	if _, err := s.GetImageMasterFile(conformance.NewImageRef().Id + ".png"); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("expected a not found error without master nor variant, got %v", err)
+	}
+
+	// the variant may be watermarked, it doesn't stand in for a master that failed to load
+	unavailable := core.NewImageService(
+		s.repository,
+		unavailableMasterStorage{storageAdapter.NewStorageAdapter(s.store, storageKeys.Flat(), nil)},
+		appHost,
+		codec.PixelLimits{},
+	)
+
+	if file, err := unavailable.GetImageMasterFile(image.Id + ".png"); err == nil {
+		t.Errorf("expected the storage error, got a file of %d bytes", len(file))
+	}
+}
+
+func TestCreateImageRejectsOversizedImages(t *testing.T) {
+	s := newService(codec.PixelLimits{MaxWidth: 16})
+
+	_, err := s.CreateImage(newCreateDto(t, "webp"), true)
+
+	var pixelLimitErr *codec.PixelLimitError
+
+	if !errors.As(err, &pixelLimitErr) {
+		t.Fatalf("expected a pixel limit error, got %v", err)
+	}
+
+	if files := s.files(t); len(files) != 0 || len(s.repository.Outbox()) != 0 {
+		t.Errorf("expected nothing to be stored, got %v", files)
+	}
+}
+
+type failingRepository struct {
+	*memoryAdapter.ImageRepository
+}
+
+func (r failingRepository) CreateImage(image core.ImageCreateDto, job *contracts.ConversionJob) (*core.ImageEntity, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestCreateImageDeletesOriginalWhenRepositoryFails(t *testing.T) {
+	store := blob.NewMemory()
+	s := core.NewImageService(
+		failingRepository{memoryAdapter.NewImageRepository()},
+		storageAdapter.NewStorageAdapter(store, storageKeys.Flat(), nil),
+		appHost,
+		codec.PixelLimits{},
+	)
+
+	if _, err := s.CreateImage(newCreateDto(t, "webp"), true); err == nil {
+		t.Fatal("expected the repository error")
+	}
+
+	if files, _ := store.List(""); len(files) != 0 {
+		t.Errorf("expected the original to be deleted, got %v", files)
+	}
+}
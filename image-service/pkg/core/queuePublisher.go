@@ -0,0 +1,5 @@
+package core
+
+type QueuePublisher interface {
+	PublishToQueue(v interface{}, priority string) error
+}
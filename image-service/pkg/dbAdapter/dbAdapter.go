@@ -1 +1,80 @@
-package dbAdapter
\ No newline at end of file
+package dbAdapter
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// any constant works as long as every instance uses the same one
+const migrationLockId = 7320451
+
+// Migrate applies the migrations not recorded in schema_migrations yet in
+// file name order, each one in its own transaction.
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(
+		"create table if not exists schema_migrations (name varchar(255) primary key, \"appliedDate\" timestamp with time zone not null default now())",
+	)
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := migrations.ReadDir("migrations")
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := applyMigration(db, entry.Name()); err != nil {
+			return fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, name string) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// instances starting at the same time wait here instead of applying a migration twice
+	if _, err := tx.Exec("select pg_advisory_xact_lock($1)", migrationLockId); err != nil {
+		return err
+	}
+
+	var applied bool
+
+	err = tx.QueryRow("select exists(select 1 from schema_migrations where name = $1)", name).Scan(&applied)
+
+	if err != nil || applied {
+		return err
+	}
+
+	migration, err := migrations.ReadFile("migrations/" + name)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(string(migration)); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("insert into schema_migrations(name) values($1)", name); err != nil {
+		return err
+	}
+
+	fmt.Println("Applied migration", name)
+
+	return tx.Commit()
+}
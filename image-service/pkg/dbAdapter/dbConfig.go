@@ -3,6 +3,7 @@ package dbAdapter
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 type DbConfig struct {
@@ -28,3 +29,64 @@ func GetPgDbConfig() DbConfig {
 		os.Getenv("Dbname"),
 	}
 }
+
+type OutboxConfig struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	ClaimTimeout   time.Duration
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+func GetOutboxConfig() OutboxConfig {
+	batchSize, err := strconv.Atoi(getEnvOrDefault("OutboxBatchSize", "100"))
+
+	if err != nil || batchSize < 1 {
+		panic("OutboxBatchSize must be a positive integer")
+	}
+
+	maxAttempts, err := strconv.Atoi(getEnvOrDefault("OutboxMaxAttempts", "50"))
+
+	if err != nil || maxAttempts < 1 {
+		panic("OutboxMaxAttempts must be a positive integer")
+	}
+
+	return OutboxConfig{
+		getDurationEnvOrDefault("OutboxPollInterval", "1s"),
+		batchSize,
+		getDurationEnvOrDefault("OutboxClaimTimeout", "5m"),
+		maxAttempts,
+		getDurationEnvOrDefault("OutboxRetryBaseDelay", "1s"),
+		getDurationEnvOrDefault("OutboxRetryMaxDelay", "5m"),
+	}
+}
+
+// retryDelay doubles with every failed attempt up to RetryMaxDelay.
+func (c OutboxConfig) retryDelay(attempts int) time.Duration {
+	delay := c.RetryBaseDelay
+
+	for i := 1; i < attempts && delay < c.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, c.RetryMaxDelay)
+}
+
+func getDurationEnvOrDefault(key string, defaultValue string) time.Duration {
+	duration, err := time.ParseDuration(getEnvOrDefault(key, defaultValue))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return duration
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
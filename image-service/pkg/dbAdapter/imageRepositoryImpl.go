@@ -2,11 +2,18 @@ package dbAdapter
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"image-common/pkg/contracts"
+	"image-common/pkg/imaging"
 	"image-service/pkg/core"
 )
 
+const imageColumns = "id, name, url, \"createdDate\", \"updatedDate\", \"availableFormats\", \"focalPointX\", \"focalPointY\", \"conversionStatus\", \"conversionError\", \"sourceName\", \"sourceOptions\""
+
 type imageRepositoryImpl struct {
 	db *sql.DB
 }
@@ -18,43 +25,13 @@ func NewImageRepository(db *sql.DB) core.ImageRepository {
 }
 
 func (r *imageRepositoryImpl) GetImageById(id string) (*core.ImageEntity, error) {
-	imageEntity := &core.ImageEntity{}
-
-	err := r.db.QueryRow("select * from image where id = $1", id).Scan(
-		&imageEntity.Id,
-		&imageEntity.Name,
-		&imageEntity.Url,
-		&imageEntity.CreatedDate,
-		&imageEntity.UpdatedDate,
-		(*pq.StringArray)(&imageEntity.AvailableFormats),
-	)
+	imageEntity, err := scanImage(r.db.QueryRow("select "+imageColumns+" from image where id = $1", id))
 
-	if err != nil {
-		return nil, err
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", core.ErrImageNotFound, id)
 	}
-	// defer rows.Close()
-
-	// imageEntity := &core.ImageEntity{}
-
-	// for rows.Next() {
-	// 	err := rows.Scan(
-	// 		&imageEntity.Id,
-	// 		&imageEntity.Name,
-	// 		&imageEntity.Url,
-	// 		&imageEntity.CreatedDate,
-	// 		&imageEntity.UpdatedDate,
-	// 		(*pq.StringArray)(&imageEntity.AvailableFormats),
-	// 	)
 
-	// 	if err != nil {
-	// 		fmt.Println(err)
-	// 		continue
-	// 	}
-
-	// 	break
-	// }
-
-	return imageEntity, nil
+	return imageEntity, err
 }
 
 func (r *imageRepositoryImpl) DeleteImageById(id string) (int, error) {
@@ -75,53 +52,245 @@ func (r *imageRepositoryImpl) DeleteImageById(id string) (int, error) {
 	return int(rowsAffected), nil
 }
 
-func (r *imageRepositoryImpl) CreateImage(image core.ImageCreateDto) (*core.ImageEntity, error) {
-	imageEntity := &core.ImageEntity{}
+func (r *imageRepositoryImpl) CreateImage(image core.ImageCreateDto, job *contracts.ConversionJob) (*core.ImageEntity, error) {
+	focalPointX, focalPointY := focalPointArgs(image.FocalPoint)
+	jobId, conversionStatus := jobArgs(job)
+	sourceName, sourceOptions, err := sourceArgs(image.Source)
 
-	err := r.db.QueryRow(
-		"insert into image(id, name, url, \"availableFormats\") values($1, $2, $3, $4) returning *",
-		image.Id,
-		image.Name,
-		image.Url,
-		pq.Array(image.AvailableFormats),
-	).Scan(
-		&imageEntity.Id,
-		&imageEntity.Name,
-		&imageEntity.Url,
-		&imageEntity.CreatedDate,
-		&imageEntity.UpdatedDate,
-		(*pq.StringArray)(&imageEntity.AvailableFormats),
+	if err != nil {
+		return nil, err
+	}
+
+	return withOutboxJob(r.db, job, func(tx *sql.Tx) (*core.ImageEntity, error) {
+		return scanImage(tx.QueryRow(
+			"insert into image(id, name, url, \"availableFormats\", \"focalPointX\", \"focalPointY\", \"jobId\", \"conversionStatus\", \"createdDate\", \"updatedDate\", \"sourceName\", \"sourceOptions\") "+
+				"values($1, $2, $3, $4, $5, $6, $7, $8, coalesce($9, now()), coalesce($9, now()), $10, $11) returning "+imageColumns,
+			image.Id,
+			image.Name,
+			image.Url,
+			pq.Array(image.AvailableFormats),
+			focalPointX,
+			focalPointY,
+			jobId,
+			conversionStatus,
+			image.CreatedDate,
+			sourceName,
+			sourceOptions,
+		))
+	})
+}
+
+func (r *imageRepositoryImpl) ListImages(afterId string, limit int) ([]core.ImageEntity, error) {
+	if afterId == "" {
+		afterId = uuid.Nil.String()
+	}
+
+	rows, err := r.db.Query(
+		"select "+imageColumns+" from image where id > $1 order by id limit $2",
+		afterId,
+		limit,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer rows.Close()
+
+	images := make([]core.ImageEntity, 0, limit)
+
+	for rows.Next() {
+		imageEntity, err := scanImage(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, *imageEntity)
+	}
+
+	return images, rows.Err()
+}
+
+// UpdateImage resets the conversion status only when there is a new job, a
+// rename keeps the status of the last one.
+func (r *imageRepositoryImpl) UpdateImage(image core.ImageEntity, job *contracts.ConversionJob) (*core.ImageEntity, error) {
+	focalPointX, focalPointY := focalPointArgs(image.FocalPoint)
+	jobId, conversionStatus := jobArgs(job)
+	sourceName, sourceOptions, err := sourceArgs(image.Source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return withOutboxJob(r.db, job, func(tx *sql.Tx) (*core.ImageEntity, error) {
+		return scanImage(tx.QueryRow(
+			"update image set name = $1, url = $2, \"updatedDate\" = $3, \"availableFormats\" = $4, \"focalPointX\" = $5, \"focalPointY\" = $6, "+
+				"\"sourceName\" = $10, \"sourceOptions\" = $11, "+
+				"\"jobId\" = coalesce($8::uuid, \"jobId\"), "+
+				"\"conversionStatus\" = coalesce($9, \"conversionStatus\"), "+
+				"\"conversionError\" = case when $8::uuid is null then \"conversionError\" end "+
+				"where id = $7 returning "+imageColumns,
+			image.Name,
+			image.Url,
+			image.UpdatedDate,
+			pq.Array(image.AvailableFormats),
+			focalPointX,
+			focalPointY,
+			image.Id,
+			jobId,
+			conversionStatus,
+			sourceName,
+			sourceOptions,
+		))
+	})
+}
+
+// withOutboxJob writes the image and its conversion job in one transaction,
+// the outbox relay publishes the job once it is committed.
+func withOutboxJob(
+	db *sql.DB,
+	job *contracts.ConversionJob,
+	writeImage func(tx *sql.Tx) (*core.ImageEntity, error),
+) (*core.ImageEntity, error) {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	imageEntity, err := writeImage(tx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if job != nil {
+		payload, err := json.Marshal(job)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("insert into outbox(payload, priority) values($1, $2)", payload, jobPriority(job))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, err
+	}
+
 	return imageEntity, nil
 }
 
-func (r *imageRepositoryImpl) UpdateImage(image core.ImageEntity) (*core.ImageEntity, error) {
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanImage(row scanner) (*core.ImageEntity, error) {
 	imageEntity := &core.ImageEntity{}
+	var focalPointX, focalPointY sql.NullFloat64
+	var sourceName sql.NullString
+	var sourceOptions []byte
 
-	err := r.db.QueryRow(
-		"update image set name = $1, url = $2, \"updatedDate\" = $3, \"availableFormats\" = $4 where id = $5 returning *",
-		image.Name,
-		image.Url,
-		image.UpdatedDate,
-		pq.Array(image.AvailableFormats),
-		image.Id,
-	).Scan(
+	err := row.Scan(
 		&imageEntity.Id,
 		&imageEntity.Name,
 		&imageEntity.Url,
 		&imageEntity.CreatedDate,
 		&imageEntity.UpdatedDate,
 		(*pq.StringArray)(&imageEntity.AvailableFormats),
+		&focalPointX,
+		&focalPointY,
+		&imageEntity.ConversionStatus,
+		&imageEntity.ConversionError,
+		&sourceName,
+		&sourceOptions,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if focalPointX.Valid && focalPointY.Valid {
+		imageEntity.FocalPoint = &imaging.FocalPoint{X: focalPointX.Float64, Y: focalPointY.Float64}
+	}
+
+	if sourceName.Valid {
+		imageEntity.Source = &core.ImageSource{Name: sourceName.String}
+
+		if err := json.Unmarshal(sourceOptions, &imageEntity.Source.Options); err != nil {
+			return nil, err
+		}
+	}
+
 	return imageEntity, nil
 }
+
+// UpdateConversionStatus only touches the image whose latest job is jobId,
+// results of jobs replaced by a newer upload are ignored.
+func (r *imageRepositoryImpl) UpdateConversionStatus(jobId string, status string, conversionError *string) (int, error) {
+	res, err := r.db.Exec(
+		"update image set \"conversionStatus\" = $1, \"conversionError\" = $2 where \"jobId\" = $3",
+		status,
+		conversionError,
+		jobId,
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func jobArgs(job *contracts.ConversionJob) (interface{}, interface{}) {
+	if job == nil {
+		return nil, nil
+	}
+
+	return job.JobId, core.ConversionPending
+}
+
+func jobPriority(job *contracts.ConversionJob) string {
+	if job.Priority == "" {
+		return contracts.PriorityInteractive
+	}
+
+	return job.Priority
+}
+
+func focalPointArgs(focalPoint *imaging.FocalPoint) (interface{}, interface{}) {
+	if focalPoint == nil {
+		return nil, nil
+	}
+
+	return focalPoint.X, focalPoint.Y
+}
+
+func sourceArgs(source *core.ImageSource) (interface{}, interface{}, error) {
+	if source == nil {
+		return nil, nil, nil
+	}
+
+	options, err := json.Marshal(source.Options)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return source.Name, string(options), nil
+}
@@ -0,0 +1,47 @@
+package dbAdapter
+
+import (
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// TestImageRepository runs against the database named by TestDbName, which
+// is migrated first. The cases only delete the images they create.
+func TestImageRepository(t *testing.T) {
+	dbName := os.Getenv("TestDbName")
+
+	if dbName == "" {
+		t.Skip("TestDbName is not set")
+	}
+
+	port, err := strconv.Atoi(getEnvOrDefault("TestDbPort", "5444"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Connect(DbConfig{
+		Host:     getEnvOrDefault("TestDbHost", "localhost"),
+		Port:     port,
+		User:     getEnvOrDefault("TestDbUser", "postgres"),
+		Password: os.Getenv("TestDbPassword"),
+		Dbname:   dbName,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	conformance.RunImageRepository(t, func(t *testing.T) core.ImageRepository {
+		return NewImageRepository(db)
+	})
+}
@@ -0,0 +1,8 @@
+create table if not exists image (
+    id uuid primary key,
+    name varchar(255) not null,
+    url text not null,
+    "createdDate" timestamp with time zone not null default now(),
+    "updatedDate" timestamp with time zone not null default now(),
+    "availableFormats" text[] not null default '{}'
+);
@@ -0,0 +1,3 @@
+alter table image
+    add column if not exists "focalPointX" double precision,
+    add column if not exists "focalPointY" double precision;
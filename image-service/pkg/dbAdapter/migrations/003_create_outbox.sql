@@ -0,0 +1,7 @@
+create table if not exists outbox (
+    id bigserial primary key,
+    payload jsonb not null,
+    "createdDate" timestamp with time zone not null default now(),
+    attempts integer not null default 0,
+    "lastError" text
+);
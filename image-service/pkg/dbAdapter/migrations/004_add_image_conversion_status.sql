@@ -0,0 +1,6 @@
+alter table image
+    add column if not exists "jobId" uuid,
+    add column if not exists "conversionStatus" varchar(16),
+    add column if not exists "conversionError" text;
+
+create index if not exists image_job_id_idx on image ("jobId");
@@ -0,0 +1,2 @@
+alter table outbox
+    add column if not exists priority varchar(16) not null default 'interactive';
@@ -0,0 +1,3 @@
+alter table image
+    add column if not exists "sourceName" text,
+    add column if not exists "sourceOptions" jsonb;
@@ -0,0 +1,5 @@
+alter table outbox
+    add column if not exists "claimedUntil" timestamp with time zone,
+    add column if not exists "nextAttemptDate" timestamp with time zone not null default now(),
+    add column if not exists parked boolean not null default false;
+create index if not exists outbox_pending on outbox (id) where not parked;
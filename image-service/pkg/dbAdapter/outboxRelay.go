@@ -0,0 +1,171 @@
+package dbAdapter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image-service/pkg/core"
+	"sort"
+	"time"
+)
+
+// OutboxRelay publishes the jobs written to the outbox. An entry is deleted
+// only after the broker confirmed it, so a crash in between publishes it
+// again: delivery is at least once and consumers have to tolerate duplicates.
+type OutboxRelay struct {
+	db             *sql.DB
+	queuePublisher core.QueuePublisher
+	config         OutboxConfig
+}
+
+type outboxEntry struct {
+	id       int64
+	payload  []byte
+	priority string
+	attempts int
+}
+
+func NewOutboxRelay(db *sql.DB, queuePublisher core.QueuePublisher, config OutboxConfig) *OutboxRelay {
+	return &OutboxRelay{
+		db,
+		queuePublisher,
+		config,
+	}
+}
+
+// Run relays batches every PollInterval until ctx is done, a full batch is
+// followed by the next one right away.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		relayed, err := r.relayBatch(ctx)
+
+		if err != nil && ctx.Err() == nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to relay the outbox", err))
+		}
+
+		if relayed == r.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// relayBatch claims the oldest entries due for ClaimTimeout, so that several
+// instances of the service relay different ones without holding a
+// transaction open across the publishes. It stops at the first failed
+// publish since the broker is most likely unavailable.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	entries, err := claimOutboxEntries(ctx, r.db, r.config.BatchSize, r.config.ClaimTimeout)
+
+	if err != nil {
+		return 0, err
+	}
+
+	relayed := 0
+
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			return relayed, releaseOutboxEntries(r.db, entries[i:])
+		}
+
+		err = r.queuePublisher.PublishToQueue(json.RawMessage(entry.payload), entry.priority)
+
+		if err != nil {
+			if failErr := r.fail(entry, err); failErr != nil {
+				return relayed, failErr
+			}
+
+			if releaseErr := releaseOutboxEntries(r.db, entries[i+1:]); releaseErr != nil {
+				return relayed, releaseErr
+			}
+
+			return relayed, err
+		}
+
+		if _, err := r.db.Exec("delete from outbox where id = $1", entry.id); err != nil {
+			return relayed, err
+		}
+
+		relayed++
+	}
+
+	return relayed, nil
+}
+
+// fail schedules the next attempt of entry with an exponential backoff, or
+// parks it after MaxAttempts. Parked entries are left to an operator.
+func (r *OutboxRelay) fail(entry outboxEntry, publishErr error) error {
+	attempts := entry.attempts + 1
+	parked := attempts >= r.config.MaxAttempts
+
+	if parked {
+		fmt.Println(fmt.Sprintf("Parked outbox entry %d after %d attempts: %s", entry.id, attempts, publishErr))
+	}
+
+	_, err := r.db.Exec(
+		"update outbox set attempts = $1, \"lastError\" = $2, parked = $3, \"claimedUntil\" = null, "+
+			"\"nextAttemptDate\" = now() + make_interval(secs => $4) where id = $5",
+		attempts,
+		publishErr.Error(),
+		parked,
+		r.config.retryDelay(attempts).Seconds(),
+		entry.id,
+	)
+
+	return err
+}
+
+func claimOutboxEntries(ctx context.Context, db *sql.DB, limit int, claimTimeout time.Duration) ([]outboxEntry, error) {
+	// a single statement, the claim is committed before anything is published
+	rows, err := db.QueryContext(
+		ctx,
+		"update outbox set \"claimedUntil\" = now() + make_interval(secs => $2) where id in ("+
+			"select id from outbox where not parked and \"nextAttemptDate\" <= now() "+
+			"and (\"claimedUntil\" is null or \"claimedUntil\" < now()) "+
+			"order by id limit $1 for update skip locked"+
+			") returning id, payload, priority, attempts",
+		limit,
+		claimTimeout.Seconds(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := make([]outboxEntry, 0)
+
+	for rows.Next() {
+		var entry outboxEntry
+
+		if err := rows.Scan(&entry.id, &entry.payload, &entry.priority, &entry.attempts); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// returning doesn't keep the order of the subquery
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+
+	return entries, rows.Err()
+}
+
+// releaseOutboxEntries gives back the claims of entries not published, the
+// next batch takes them without waiting for ClaimTimeout.
+func releaseOutboxEntries(db *sql.DB, entries []outboxEntry) error {
+	for _, entry := range entries {
+		if _, err := db.Exec("update outbox set \"claimedUntil\" = null where id = $1", entry.id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package dbAdapter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxRetryDelay(t *testing.T) {
+	config := OutboxConfig{RetryBaseDelay: time.Second, RetryMaxDelay: time.Minute}
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute},
+		{1000, time.Minute},
+	}
+
+	for _, test := range tests {
+		if delay := config.retryDelay(test.attempts); delay != test.expected {
+			t.Errorf("expected %s after %d attempts, got %s", test.expected, test.attempts, delay)
+		}
+	}
+}
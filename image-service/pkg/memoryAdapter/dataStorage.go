@@ -0,0 +1,14 @@
+package memoryAdapter
+
+import (
+	"image-common/pkg/blob"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/core"
+	"image-service/pkg/storageAdapter"
+)
+
+// NewDataStorage converts the images like the S3 and filesystem storages do
+// and keeps the files in the process, in the flat key layout.
+func NewDataStorage() core.DataStorage {
+	return storageAdapter.NewStorageAdapter(blob.NewMemory(), storageKeys.Flat(), nil)
+}
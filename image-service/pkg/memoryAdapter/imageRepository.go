@@ -0,0 +1,231 @@
+package memoryAdapter
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/contracts"
+	"image-common/pkg/imaging"
+	"image-service/pkg/core"
+	"sort"
+	"sync"
+	"time"
+)
+
+type imageRecord struct {
+	image core.ImageEntity
+	jobId string
+}
+
+// ImageRepository keeps the images in the process the way the Postgres
+// repository does, with the jobs it would have written to the outbox.
+type ImageRepository struct {
+	mu     sync.Mutex
+	images map[string]*imageRecord
+	outbox []contracts.ConversionJob
+}
+
+func NewImageRepository() *ImageRepository {
+	return &ImageRepository{
+		images: make(map[string]*imageRecord),
+	}
+}
+
+func (r *ImageRepository) GetImageById(id string) (*core.ImageEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.images[id]
+
+	if !ok {
+		return nil, notFound(id)
+	}
+
+	return copyImage(record.image), nil
+}
+
+func (r *ImageRepository) DeleteImageById(id string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.images[id]; !ok {
+		return 0, nil
+	}
+
+	delete(r.images, id)
+
+	return 1, nil
+}
+
+func (r *ImageRepository) CreateImage(image core.ImageCreateDto, job *contracts.ConversionJob) (*core.ImageEntity, error) {
+	if image.Id == nil || image.Name == nil || image.Url == nil {
+		return nil, errors.New("Image id, name and url are required")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.images[*image.Id]; ok {
+		return nil, errors.New(fmt.Sprintf("Image %s already exists", *image.Id))
+	}
+
+	createdDate := time.Now()
+
+	if image.CreatedDate != nil {
+		createdDate = *image.CreatedDate
+	}
+
+	record := &imageRecord{
+		image: core.ImageEntity{
+			Id:               *image.Id,
+			Name:             *image.Name,
+			Url:              *image.Url,
+			CreatedDate:      createdDate,
+			UpdatedDate:      createdDate,
+			AvailableFormats: append([]string{}, image.AvailableFormats...),
+			FocalPoint:       copyFocalPoint(image.FocalPoint),
+			Source:           copySource(image.Source),
+		},
+	}
+
+	r.setJob(record, job)
+	r.images[*image.Id] = record
+
+	return copyImage(record.image), nil
+}
+
+// UpdateImage resets the conversion status only when there is a new job, a
+// rename keeps the status of the last one.
+func (r *ImageRepository) UpdateImage(image core.ImageEntity, job *contracts.ConversionJob) (*core.ImageEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.images[image.Id]
+
+	if !ok {
+		return nil, notFound(image.Id)
+	}
+
+	record.image.Name = image.Name
+	record.image.Url = image.Url
+	record.image.UpdatedDate = image.UpdatedDate
+	record.image.AvailableFormats = append([]string{}, image.AvailableFormats...)
+	record.image.FocalPoint = copyFocalPoint(image.FocalPoint)
+	record.image.Source = copySource(image.Source)
+
+	r.setJob(record, job)
+
+	return copyImage(record.image), nil
+}
+
+// UpdateConversionStatus only touches the image whose latest job is jobId,
+// results of jobs replaced by a newer upload are ignored.
+func (r *ImageRepository) UpdateConversionStatus(jobId string, status string, conversionError *string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	updated := 0
+
+	for _, record := range r.images {
+		if record.jobId == "" || record.jobId != jobId {
+			continue
+		}
+
+		record.image.ConversionStatus = &status
+		record.image.ConversionError = copyString(conversionError)
+		updated++
+	}
+
+	return updated, nil
+}
+
+func (r *ImageRepository) ListImages(afterId string, limit int) ([]core.ImageEntity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, 0, len(r.images))
+
+	for id := range r.images {
+		if id > afterId {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	images := make([]core.ImageEntity, 0, len(ids))
+
+	for _, id := range ids {
+		images = append(images, *copyImage(r.images[id].image))
+	}
+
+	return images, nil
+}
+
+// Outbox returns the jobs written with the images, oldest first.
+func (r *ImageRepository) Outbox() []contracts.ConversionJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]contracts.ConversionJob{}, r.outbox...)
+}
+
+func (r *ImageRepository) setJob(record *imageRecord, job *contracts.ConversionJob) {
+	if job == nil {
+		return
+	}
+
+	status := core.ConversionPending
+
+	record.jobId = job.JobId
+	record.image.ConversionStatus = &status
+	record.image.ConversionError = nil
+	r.outbox = append(r.outbox, *job)
+}
+
+func notFound(id string) error {
+	return fmt.Errorf("%w: %s", core.ErrImageNotFound, id)
+}
+
+func copyImage(image core.ImageEntity) *core.ImageEntity {
+	image.AvailableFormats = append([]string{}, image.AvailableFormats...)
+	image.FocalPoint = copyFocalPoint(image.FocalPoint)
+	image.Source = copySource(image.Source)
+	image.ConversionStatus = copyString(image.ConversionStatus)
+	image.ConversionError = copyString(image.ConversionError)
+
+	return &image
+}
+
+func copyFocalPoint(focalPoint *imaging.FocalPoint) *imaging.FocalPoint {
+	if focalPoint == nil {
+		return nil
+	}
+
+	copied := *focalPoint
+
+	return &copied
+}
+
+func copySource(source *core.ImageSource) *core.ImageSource {
+	if source == nil {
+		return nil
+	}
+
+	copied := *source
+
+	return &copied
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+
+	copied := *s
+
+	return &copied
+}
@@ -0,0 +1,19 @@
+package memoryAdapter
+
+import (
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"testing"
+)
+
+func TestDataStorage(t *testing.T) {
+	conformance.RunDataStorage(t, func(t *testing.T) core.DataStorage {
+		return NewDataStorage()
+	})
+}
+
+func TestImageRepository(t *testing.T) {
+	conformance.RunImageRepository(t, func(t *testing.T) core.ImageRepository {
+		return NewImageRepository()
+	})
+}
@@ -0,0 +1,51 @@
+package queueAdapter
+
+import (
+	"encoding/json"
+	"image-common/pkg/contracts"
+	"image-common/pkg/transport"
+)
+
+type QueueAdapter struct {
+	transport transport.Transport
+	queueName string
+}
+
+func NewQueueAdapter(t transport.Transport, queueName string) *QueueAdapter {
+	return &QueueAdapter{
+		t,
+		queueName,
+	}
+}
+
+// DeclareQueues declares the job queue of each priority and the queue
+// image-saver reports results to.
+func DeclareQueues(t transport.Transport, queueName string) error {
+	names := []string{
+		contracts.LaneQueueName(queueName, contracts.PriorityInteractive),
+		contracts.LaneQueueName(queueName, contracts.PriorityBulk),
+		contracts.ResultQueueName(queueName),
+	}
+
+	for _, name := range names {
+		err := t.DeclareQueue(name, transport.QueueOptions{})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PublishToQueue fails while disconnected rather than piling messages up,
+// the outbox relay publishes them again later.
+func (a *QueueAdapter) PublishToQueue(v interface{}, priority string) error {
+	bytes, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	return a.transport.Publish(contracts.LaneQueueName(a.queueName, priority), transport.Message{Body: bytes})
+}
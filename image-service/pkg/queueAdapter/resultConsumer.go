@@ -0,0 +1,45 @@
+package queueAdapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image-common/pkg/contracts"
+	"image-common/pkg/transport"
+	"time"
+)
+
+// the results are handled one at a time, a few more are prefetched to keep
+// the round trips to the broker out of the way
+var resultConsumeOptions = transport.ConsumeOptions{Concurrency: 1, Prefetch: 10}
+
+// ConsumeResults passes the conversion results image-saver reports to handle
+// until ctx is done.
+func (a *QueueAdapter) ConsumeResults(ctx context.Context, handle func(result contracts.ConversionResult) error) error {
+	return a.transport.Consume(ctx, contracts.ResultQueueName(a.queueName), resultConsumeOptions, func(delivery transport.Delivery) {
+		handleResult(delivery, handle)
+	})
+}
+
+func handleResult(delivery transport.Delivery, handle func(result contracts.ConversionResult) error) {
+	result, err := contracts.DecodeConversionResult(delivery.Message().Body)
+
+	if err == nil {
+		err = handle(*result)
+	}
+
+	var validationErr *contracts.ValidationError
+
+	switch {
+	case err == nil:
+		delivery.Ack()
+	case errors.As(err, &validationErr):
+		fmt.Println(fmt.Sprintf("%s: %s", "Dropping an invalid conversion result", err))
+		delivery.Reject(false)
+	default:
+		// newer result versions wait for an upgraded instance, database errors for the database
+		fmt.Println(fmt.Sprintf("%s: %s", "Failed to handle a conversion result", err))
+		time.Sleep(time.Second)
+		delivery.Reject(true)
+	}
+}
@@ -1,4 +1,4 @@
-package rmqAdapter
+package queueAdapter
 
 import (
 	"os"
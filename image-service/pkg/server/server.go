@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"image-service/api/handlers"
+	"image-service/api/routers"
+	"image-service/pkg/core"
+	"image-service/pkg/dbAdapter"
+	"image-service/pkg/queueAdapter"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Server is the HTTP API together with the outbox relay and the consumer of
+// conversion results, the parts of image-service that run in the background.
+type Server struct {
+	app          *fiber.App
+	imageService core.ImageService
+	outboxRelay  *dbAdapter.OutboxRelay
+	queueAdapter *queueAdapter.QueueAdapter
+}
+
+func NewServer(db *sql.DB, dataStorage core.DataStorage, queue *queueAdapter.QueueAdapter, config ServerConfig) *Server {
+	imageService := core.NewImageService(
+		dbAdapter.NewImageRepository(db),
+		dataStorage,
+		config.AppHost,
+		config.PixelLimits,
+	)
+
+	app := fiber.New()
+
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("Hello, World!")
+	})
+
+	api := app.Group("/api")
+	routers.ImageRouter(api, imageService, handlers.GetAuthConfig())
+
+	return &Server{
+		app,
+		imageService,
+		dbAdapter.NewOutboxRelay(db, queue, dbAdapter.GetOutboxConfig()),
+		queue,
+	}
+}
+
+// Run serves on addr until ctx is done, then waits up to shutdownTimeout for
+// the requests in progress before stopping the background work.
+func (s *Server) Run(ctx context.Context, addr string, shutdownTimeout time.Duration) error {
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	resultsDone := make(chan struct{})
+
+	go func() {
+		s.outboxRelay.Run(backgroundCtx)
+		close(relayDone)
+	}()
+
+	go func() {
+		err := s.queueAdapter.ConsumeResults(backgroundCtx, s.imageService.HandleConversionResult)
+
+		if err != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to consume conversion results", err))
+		}
+
+		close(resultsDone)
+	}()
+
+	listenErr := make(chan error, 1)
+
+	go func() {
+		listenErr <- s.app.Listen(addr)
+	}()
+
+	var err error
+
+	select {
+	case err = <-listenErr:
+	case <-ctx.Done():
+		fmt.Println("Shutting down, waiting for requests in progress")
+
+		// stops accepting connections and waits for the open ones up to the timeout
+		if shutdownErr := s.app.ShutdownWithTimeout(shutdownTimeout); shutdownErr != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to shut down the server gracefully", shutdownErr))
+		}
+
+		err = <-listenErr
+	}
+
+	// entries left in the outbox are relayed after the restart, unacked results are redelivered
+	stopBackground()
+	<-relayDone
+	<-resultsDone
+
+	return err
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"image-common/pkg/codec"
+	"os"
+	"strconv"
+)
+
+type ServerConfig struct {
+	AppHost     string
+	PixelLimits codec.PixelLimits
+}
+
+func GetServerConfig() ServerConfig {
+	maxWidth, err := strconv.Atoi(getEnvOrDefault("MaxImageWidth", "20000"))
+
+	if err != nil || maxWidth < 0 {
+		panic("MaxImageWidth must be a non-negative integer")
+	}
+
+	maxHeight, err := strconv.Atoi(getEnvOrDefault("MaxImageHeight", "20000"))
+
+	if err != nil || maxHeight < 0 {
+		panic("MaxImageHeight must be a non-negative integer")
+	}
+
+	maxMegapixels, err := strconv.ParseFloat(getEnvOrDefault("MaxImageMegapixels", "100"), 64)
+
+	if err != nil || maxMegapixels < 0 {
+		panic("MaxImageMegapixels must be a non-negative number")
+	}
+
+	return ServerConfig{
+		getEnvOrDefault("AppHost", "http://localhost:3000"),
+		codec.PixelLimits{
+			MaxWidth:      maxWidth,
+			MaxHeight:     maxHeight,
+			MaxMegapixels: maxMegapixels,
+		},
+	}
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
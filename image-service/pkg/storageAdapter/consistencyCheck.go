@@ -0,0 +1,485 @@
+package storageAdapter
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/blob"
+	"image-common/pkg/codec"
+	"image-common/pkg/contracts"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/core"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ConsistencyOptions struct {
+	// DeleteOrphans deletes the orphaned files and the leftover originals.
+	DeleteOrphans bool
+	// Reconvert queues a bulk job for the missing variants of an image,
+	// converted from its original or from a master, which is not watermarked.
+	Reconvert bool
+	// MinAge spares the files of the requests in progress, which are stored
+	// before the row of their image.
+	MinAge time.Duration
+}
+
+type ConsistencyReport struct {
+	// Orphans are the files of images that don't exist, or of formats and
+	// creation dates the images don't have.
+	Orphans []string
+	// LeftoverOriginals are the originals of images with no conversion
+	// pending, which image-saver failed to delete.
+	LeftoverOriginals []string
+	// MissingVariants are the formats without a file by image id, images
+	// with a conversion pending aside.
+	MissingVariants map[string][]string
+	// Unrecoverable are the images with missing variants and neither an
+	// original nor a master to convert them from.
+	Unrecoverable []string
+	// UnknownKeys are of neither layout, they are reported but never deleted.
+	UnknownKeys []string
+	// Recent counts the files younger than MinAge, which are not checked.
+	Recent      int
+	Deleted     int
+	Reconverted int
+}
+
+type storedFile struct {
+	key    string
+	parsed storageKeys.Key
+}
+
+// CheckConsistency compares the files of the layouts of keys and
+// previousKeys with the images of repository. Every finding is checked
+// again against the repository before it is reported or repaired, images
+// created during the check are left alone. The reconversions go through
+// dataStorage, which encrypts the originals when the service does.
+func CheckConsistency(
+	repository core.ImageRepository,
+	store blob.Store,
+	dataStorage core.DataStorage,
+	keys *storageKeys.Scheme,
+	previousKeys *storageKeys.Scheme,
+	options ConsistencyOptions,
+) (*ConsistencyReport, error) {
+	schemes := []*storageKeys.Scheme{keys}
+
+	if previousKeys != nil {
+		schemes = append(schemes, previousKeys)
+	}
+
+	images, err := listAllImages(repository)
+
+	if err != nil {
+		return nil, err
+	}
+
+	storedKeys, err := listSchemeKeys(store, schemes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ConsistencyReport{MissingVariants: make(map[string][]string)}
+	filesByImage := make(map[string][]storedFile)
+	// in the order of the listing, for a stable report
+	fileImageIds := make([]string, 0)
+
+	for _, key := range storedKeys {
+		parsed, ok := parseKey(schemes, key)
+
+		if !ok {
+			report.UnknownKeys = append(report.UnknownKeys, key)
+			continue
+		}
+
+		// the markers are deleted by image-saver once they expire
+		if parsed.Kind == storageKeys.KindJobMarker {
+			continue
+		}
+
+		if _, prs := filesByImage[parsed.Id]; !prs {
+			fileImageIds = append(fileImageIds, parsed.Id)
+		}
+
+		filesByImage[parsed.Id] = append(filesByImage[parsed.Id], storedFile{key, parsed})
+	}
+
+	c := &consistencyCheck{repository, store, dataStorage, schemes, options, report}
+
+	imagesById := make(map[string]core.ImageEntity, len(images))
+
+	for _, image := range images {
+		if err := c.checkVariants(image, filesByImage[image.Id]); err != nil {
+			return nil, err
+		}
+
+		imagesById[image.Id] = image
+	}
+
+	// after the reconversions, which take over the leftover originals
+	for _, id := range fileImageIds {
+		image, exists := imagesById[id]
+
+		for _, file := range filesByImage[id] {
+			if exists && isExpectedFile(image, file, schemes) {
+				continue
+			}
+
+			if err := c.checkFile(id, file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+type consistencyCheck struct {
+	repository  core.ImageRepository
+	store       blob.Store
+	dataStorage core.DataStorage
+	schemes     []*storageKeys.Scheme
+	options     ConsistencyOptions
+	report      *ConsistencyReport
+}
+
+func (c *consistencyCheck) checkVariants(image core.ImageEntity, files []storedFile) error {
+	missingFormats := missingFormats(image, files, c.schemes)
+
+	if len(missingFormats) == 0 || isPending(image) {
+		return nil
+	}
+
+	current, err := c.repository.GetImageById(image.Id)
+
+	if errors.Is(err, core.ErrImageNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if isPending(*current) {
+		return nil
+	}
+
+	c.report.MissingVariants[image.Id] = missingFormats
+
+	source := sourceFile(*current, files, c.schemes)
+
+	if source == nil {
+		c.report.Unrecoverable = append(c.report.Unrecoverable, image.Id)
+		return nil
+	}
+
+	if !c.options.Reconvert {
+		return nil
+	}
+
+	file, err := c.dataStorage.GetFile(source.key)
+
+	if errors.Is(err, blob.ErrNotFound) {
+		c.report.Unrecoverable = append(c.report.Unrecoverable, image.Id)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	job, err := c.dataStorage.SaveImageAsync(
+		file,
+		path.Base(source.key),
+		storageKeys.ImageRef{Id: current.Id, CreatedDate: current.CreatedDate},
+		missingFormats,
+		reconvertOptions(*current, source),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	// the kept original is stored again under the current layout
+	keepsSource := current.Source != nil && source.key == current.Source.Name
+
+	if keepsSource {
+		job.KeepOriginal = true
+		current.Source = &core.ImageSource{Name: job.OriginalImageName, Options: current.Source.Options}
+	}
+
+	if len(job.SaveFormats) == 0 {
+		c.deleteJobOriginal(job, source)
+		return nil
+	}
+
+	current.UpdatedDate = time.Now()
+
+	if _, err := c.repository.UpdateImage(*current, job); err != nil {
+		c.deleteJobOriginal(job, source)
+		return err
+	}
+
+	c.report.Reconverted++
+
+	if keepsSource && job.OriginalImageName != source.key {
+		if err := c.store.Delete(source.key); err != nil {
+			fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the previous original image file", err))
+		}
+	}
+
+	return nil
+}
+
+// reconvertOptions are the options of the upload for the original the image
+// keeps, the others are not kept. A master has them applied already.
+func reconvertOptions(image core.ImageEntity, source *storedFile) core.ConversionOptions {
+	var options core.ConversionOptions
+
+	if image.Source != nil && source.key == image.Source.Name {
+		options = image.Source.Options
+	}
+
+	priority := contracts.PriorityBulk
+	options.FocalPoint = image.FocalPoint
+	options.Priority = &priority
+
+	return options
+}
+
+func (c *consistencyCheck) deleteJobOriginal(job *contracts.ConversionJob, source *storedFile) {
+	if job.OriginalImageName == source.key {
+		return
+	}
+
+	if err := c.store.Delete(job.OriginalImageName); err != nil {
+		fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the original image file", err))
+	}
+}
+
+// checkFile reports a file that doesn't match the image it belongs to, as
+// seen when the images were listed.
+func (c *consistencyCheck) checkFile(id string, file storedFile) error {
+	modTime, err := c.store.ModTime(file.key)
+
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if time.Since(modTime) < c.options.MinAge {
+		c.report.Recent++
+		return nil
+	}
+
+	image, err := c.repository.GetImageById(id)
+
+	switch {
+	case errors.Is(err, core.ErrImageNotFound):
+		c.report.Orphans = append(c.report.Orphans, file.key)
+	case err != nil:
+		return err
+	case isExpectedFile(*image, file, c.schemes):
+		return nil
+	case file.parsed.Kind == storageKeys.KindOriginal && isOriginalKey(*image, file, c.schemes):
+		c.report.LeftoverOriginals = append(c.report.LeftoverOriginals, file.key)
+	default:
+		c.report.Orphans = append(c.report.Orphans, file.key)
+	}
+
+	if !c.options.DeleteOrphans {
+		return nil
+	}
+
+	if err := c.store.Delete(file.key); err != nil {
+		return err
+	}
+
+	c.report.Deleted++
+
+	return nil
+}
+
+// isExpectedFile tells whether file is a variant or a master of a format of
+// image, its original while its conversion is pending, in either layout, or
+// the original it keeps to be cropped again.
+func isExpectedFile(image core.ImageEntity, file storedFile, schemes []*storageKeys.Scheme) bool {
+	if image.Source != nil && file.key == image.Source.Name {
+		return true
+	}
+
+	if file.parsed.Kind == storageKeys.KindOriginal {
+		return isPending(image) && isOriginalKey(image, file, schemes)
+	}
+
+	if !contains(image.AvailableFormats, file.parsed.Format) {
+		return false
+	}
+
+	ref := storageKeys.ImageRef{Id: image.Id, CreatedDate: image.CreatedDate}
+
+	for _, keys := range schemes {
+		if keys.Check(ref) != nil {
+			continue
+		}
+
+		if file.key == keys.Variant(ref, file.parsed.Format) || file.key == keys.Master(ref, file.parsed.Format) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isOriginalKey(image core.ImageEntity, file storedFile, schemes []*storageKeys.Scheme) bool {
+	ref := storageKeys.ImageRef{Id: image.Id, CreatedDate: image.CreatedDate}
+
+	for _, keys := range schemes {
+		if keys.Check(ref) == nil && file.key == keys.Original(ref, file.parsed.Format) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func missingFormats(image core.ImageEntity, files []storedFile, schemes []*storageKeys.Scheme) []string {
+	missing := make([]string, 0)
+
+	for _, format := range image.AvailableFormats {
+		found := false
+
+		for _, file := range files {
+			if file.parsed.Kind == storageKeys.KindVariant && file.parsed.Format == format && isExpectedFile(image, file, schemes) {
+				found = true
+				break
+			}
+		}
+
+		// formats image-saver can't produce were never going to have a file
+		if f, prs := codec.FormatByExtension(format); !found && prs && f.Capabilities.Encode {
+			missing = append(missing, format)
+		}
+	}
+
+	return missing
+}
+
+// sourceFile prefers the original the image keeps, then a leftover original,
+// then the masters in the order of the formats of image. The variants may be
+// watermarked and are never converted again.
+func sourceFile(image core.ImageEntity, files []storedFile, schemes []*storageKeys.Scheme) *storedFile {
+	var source *storedFile
+	rank := 0
+
+	for i, file := range files {
+		fileRank := 0
+
+		switch {
+		case image.Source != nil && file.key == image.Source.Name:
+			fileRank = len(image.AvailableFormats) + 2
+		case file.parsed.Kind == storageKeys.KindOriginal && isOriginalKey(image, file, schemes):
+			fileRank = len(image.AvailableFormats) + 1
+		case file.parsed.Kind == storageKeys.KindMaster && isExpectedFile(image, file, schemes):
+			fileRank = len(image.AvailableFormats) - indexOf(image.AvailableFormats, file.parsed.Format)
+		}
+
+		if fileRank > rank {
+			source, rank = &files[i], fileRank
+		}
+	}
+
+	return source
+}
+
+func listAllImages(repository core.ImageRepository) ([]core.ImageEntity, error) {
+	images := make([]core.ImageEntity, 0)
+	afterId := ""
+
+	for {
+		page, err := repository.ListImages(afterId, 500)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(page) == 0 {
+			return images, nil
+		}
+
+		images = append(images, page...)
+		afterId = page[len(page)-1].Id
+	}
+}
+
+// listSchemeKeys lists the roots of the layouts once, the root of one can
+// contain the other.
+func listSchemeKeys(store blob.Store, schemes []*storageKeys.Scheme) ([]string, error) {
+	roots := make([]string, 0, len(schemes))
+
+	for _, keys := range schemes {
+		roots = append(roots, keys.Root())
+	}
+
+	sort.Strings(roots)
+
+	storedKeys := make([]string, 0)
+	listed := make([]string, 0, len(roots))
+
+	for _, root := range roots {
+		covered := false
+
+		for _, listedRoot := range listed {
+			covered = covered || strings.HasPrefix(root, listedRoot)
+		}
+
+		if covered {
+			continue
+		}
+
+		rootKeys, err := store.List(root)
+
+		if err != nil {
+			return nil, err
+		}
+
+		storedKeys = append(storedKeys, rootKeys...)
+		listed = append(listed, root)
+	}
+
+	return storedKeys, nil
+}
+
+func parseKey(schemes []*storageKeys.Scheme, key string) (storageKeys.Key, bool) {
+	for _, keys := range schemes {
+		if parsed, ok := keys.Parse(key); ok {
+			return parsed, true
+		}
+	}
+
+	return storageKeys.Key{}, false
+}
+
+func isPending(image core.ImageEntity) bool {
+	return image.ConversionStatus != nil && *image.ConversionStatus == core.ConversionPending
+}
+
+func contains(values []string, value string) bool {
+	return indexOf(values, value) >= 0
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+
+	return -1
+}
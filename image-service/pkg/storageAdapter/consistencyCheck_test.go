@@ -0,0 +1,283 @@
+package storageAdapter_test
+
+import (
+	"bytes"
+	"image-common/pkg/blob"
+	"image-common/pkg/contracts"
+	"image-common/pkg/envelope"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"image-service/pkg/memoryAdapter"
+	"image-service/pkg/storageAdapter"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newImage(t *testing.T, repository core.ImageRepository, conversionStatus string, formats ...string) storageKeys.ImageRef {
+	id := uuid.New().String()
+	url := "http://localhost:3000/api/get-file/" + id + "." + formats[0]
+	createdDate := time.Now().UTC().Truncate(time.Microsecond)
+	var job *contracts.ConversionJob
+
+	if conversionStatus != "" {
+		job = &contracts.ConversionJob{Version: contracts.ConversionJobVersion, JobId: uuid.New().String(), SaveFormats: formats}
+	}
+
+	_, err := repository.CreateImage(core.ImageCreateDto{
+		Id:               &id,
+		Name:             &id,
+		Url:              &url,
+		AvailableFormats: formats,
+		CreatedDate:      &createdDate,
+	}, job)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job != nil && conversionStatus != core.ConversionPending {
+		if _, err := repository.UpdateConversionStatus(job.JobId, conversionStatus, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return storageKeys.ImageRef{Id: id, CreatedDate: createdDate}
+}
+
+func TestCheckConsistency(t *testing.T) {
+	store := blob.NewMemory()
+	repository := memoryAdapter.NewImageRepository()
+	flat := storageKeys.Flat()
+	keys, err := storageKeys.NewScheme(storageKeys.Config{Prefix: "tenant", Sharding: storageKeys.ShardingHash})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataStorage := storageAdapter.NewStorageAdapter(store, keys, flat)
+	png := conformance.NewPng(t, 8, 8)
+
+	complete := newImage(t, repository, "", "png", "jpg")
+	store.Put(keys.Variant(complete, "png"), png)
+	store.Put(keys.Variant(complete, "jpg"), png)
+	store.Put(keys.Master(complete, "jpg"), png)
+
+	// the webp variant failed, the png is still in the previous layout
+	partial := newImage(t, repository, contracts.ResultFailed, "png", "webp")
+	store.Put(flat.Variant(partial, "png"), png)
+	store.Put(flat.Original(partial, "png"), png)
+
+	leftover := newImage(t, repository, contracts.ResultCompleted, "png")
+	store.Put(keys.Variant(leftover, "png"), png)
+	store.Put(keys.Original(leftover, "png"), png)
+
+	lost := newImage(t, repository, contracts.ResultFailed, "png")
+
+	inProgress := newImage(t, repository, core.ConversionPending, "webp")
+	store.Put(keys.Original(inProgress, "png"), png)
+
+	orphans := []string{
+		keys.Variant(storageKeys.ImageRef{Id: uuid.New().String()}, "png"),
+		keys.Variant(complete, "gif"),
+	}
+
+	for _, orphan := range orphans {
+		store.Put(orphan, png)
+	}
+
+	store.Put("tenant/notes.txt", []byte("notes"))
+	store.Put(keys.JobMarker(uuid.New().String(), "png"), []byte{})
+
+	report, err := storageAdapter.CheckConsistency(repository, store, dataStorage, keys, flat, storageAdapter.ConsistencyOptions{
+		DeleteOrphans: true,
+		MinAge:        time.Hour,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedMissing := map[string][]string{partial.Id: {"webp"}, lost.Id: {"png"}}
+
+	if !reflect.DeepEqual(report.MissingVariants, expectedMissing) {
+		t.Errorf("expected the missing variants %v, got %v", expectedMissing, report.MissingVariants)
+	}
+
+	if len(report.Unrecoverable) != 1 || report.Unrecoverable[0] != lost.Id {
+		t.Errorf("expected %s to be unrecoverable, got %v", lost.Id, report.Unrecoverable)
+	}
+
+	if len(report.UnknownKeys) != 1 || report.UnknownKeys[0] != "tenant/notes.txt" {
+		t.Errorf("expected the unknown key to be reported, got %v", report.UnknownKeys)
+	}
+
+	if report.Recent != 4 || report.Deleted != 0 || len(report.Orphans) != 0 {
+		t.Errorf("expected the recent files to be spared, got %+v", report)
+	}
+
+	report, err = storageAdapter.CheckConsistency(repository, store, dataStorage, keys, flat, storageAdapter.ConsistencyOptions{
+		DeleteOrphans: true,
+		Reconvert:     true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(report.Orphans)
+	sort.Strings(orphans)
+
+	if !reflect.DeepEqual(report.Orphans, orphans) {
+		t.Errorf("expected the orphans %v, got %v", orphans, report.Orphans)
+	}
+
+	// the original of partial is kept for its new job
+	if len(report.LeftoverOriginals) != 1 || report.LeftoverOriginals[0] != keys.Original(leftover, "png") {
+		t.Errorf("expected the original of %s to be left over, got %v", leftover.Id, report.LeftoverOriginals)
+	}
+
+	if report.Deleted != 3 || report.Reconverted != 1 {
+		t.Errorf("expected 3 deleted files and 1 reconversion, got %+v", report)
+	}
+
+	for _, key := range append(orphans, keys.Original(leftover, "png")) {
+		if exists, _ := store.Exists(key); exists {
+			t.Errorf("expected %s to be deleted", key)
+		}
+	}
+
+	for _, key := range []string{keys.Variant(complete, "png"), keys.Master(complete, "jpg"), keys.Original(inProgress, "png"), "tenant/notes.txt"} {
+		if exists, _ := store.Exists(key); !exists {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+
+	outbox := repository.Outbox()
+	job := outbox[len(outbox)-1]
+
+	if job.SaveName != partial.Id || !reflect.DeepEqual(job.SaveFormats, []string{"webp"}) || job.Priority != contracts.PriorityBulk {
+		t.Errorf("expected a bulk job for the webp of %s, got %+v", partial.Id, job)
+	}
+
+	if job.OriginalImageName != keys.Original(partial, "png") {
+		t.Errorf("expected the job to be converted from the original, got %s", job.OriginalImageName)
+	}
+
+	image, err := repository.GetImageById(partial.Id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.ConversionStatus == nil || *image.ConversionStatus != core.ConversionPending {
+		t.Errorf("expected the conversion of %s to be pending, got %v", partial.Id, image.ConversionStatus)
+	}
+}
+
+func TestCheckConsistencyReconvertSources(t *testing.T) {
+	store := blob.NewMemory()
+	repository := memoryAdapter.NewImageRepository()
+	flat := storageKeys.Flat()
+	keys, err := storageKeys.NewScheme(storageKeys.Config{Prefix: "tenant"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := envelope.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataStorage := storageAdapter.NewEncryptedStorage(storageAdapter.NewStorageAdapter(store, keys, flat), keys, keyring)
+	png := conformance.NewPng(t, 8, 8)
+
+	// the original kept to be cropped again is still in the previous layout
+	kept := newImage(t, repository, "", "png", "webp")
+	cropAspectRatio := "16:9"
+	maxWidth := 100
+	image, err := repository.GetImageById(kept.Id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image.Source = &core.ImageSource{
+		Name:    flat.Original(kept, "png"),
+		Options: core.ConversionOptions{CropAspectRatio: &cropAspectRatio, MaxWidth: &maxWidth},
+	}
+
+	if _, err := repository.UpdateImage(*image, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Put(keys.Variant(kept, "png"), png)
+	store.Put(flat.Original(kept, "png"), png)
+
+	watermarked := newImage(t, repository, contracts.ResultFailed, "jpg", "webp")
+	store.Put(keys.Variant(watermarked, "jpg"), png)
+	store.Put(keys.Master(watermarked, "jpg"), png)
+
+	// the variant may be watermarked, it is not converted again
+	variantOnly := newImage(t, repository, contracts.ResultFailed, "png", "webp")
+	store.Put(keys.Variant(variantOnly, "png"), png)
+
+	report, err := storageAdapter.CheckConsistency(repository, store, dataStorage, keys, flat, storageAdapter.ConsistencyOptions{
+		Reconvert: true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Unrecoverable) != 1 || report.Unrecoverable[0] != variantOnly.Id {
+		t.Errorf("expected %s to be unrecoverable, got %v", variantOnly.Id, report.Unrecoverable)
+	}
+
+	if report.Reconverted != 2 {
+		t.Errorf("expected 2 reconversions, got %d", report.Reconverted)
+	}
+
+	jobs := make(map[string]contracts.ConversionJob)
+
+	for _, job := range repository.Outbox() {
+		jobs[job.SaveName] = job
+	}
+
+	keptJob := jobs[kept.Id]
+
+	if keptJob.OriginalImageName != keys.Original(kept, "png") || !keptJob.KeepOriginal ||
+		keptJob.CropAspectRatio != cropAspectRatio || keptJob.MaxWidth != maxWidth || keptJob.Priority != contracts.PriorityBulk {
+		t.Errorf("expected a job with the options of the upload keeping the original, got %+v", keptJob)
+	}
+
+	image, err = repository.GetImageById(kept.Id)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if image.Source == nil || image.Source.Name != keys.Original(kept, "png") {
+		t.Errorf("expected the source to move to the current layout, got %+v", image.Source)
+	}
+
+	if exists, _ := store.Exists(flat.Original(kept, "png")); exists {
+		t.Error("expected the source in the previous layout to be deleted")
+	}
+
+	if original, err := store.Get(keys.Original(kept, "png")); err != nil || !envelope.IsEncrypted(original) {
+		t.Errorf("expected the original to be stored encrypted, got %v", err)
+	}
+
+	masterJob := jobs[watermarked.Id]
+
+	if masterJob.OriginalImageName != keys.Original(watermarked, "jpg") || masterJob.KeepOriginal || masterJob.CropAspectRatio != "" {
+		t.Errorf("expected a job converting the master, got %+v", masterJob)
+	}
+}
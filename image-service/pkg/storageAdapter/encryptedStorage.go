@@ -0,0 +1,66 @@
+package storageAdapter
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/contracts"
+	"image-common/pkg/envelope"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/core"
+)
+
+type encryptedStorage struct {
+	core.DataStorage
+	keys    *storageKeys.Scheme
+	keyring *envelope.Keyring
+}
+
+// NewEncryptedStorage encrypts the originals kept for the conversion jobs,
+// which image-saver decrypts with the same keys. The variants are served to
+// anyone and stay in the clear. keys is the layout dataStorage writes the
+// originals in, every original is encrypted for its key.
+func NewEncryptedStorage(dataStorage core.DataStorage, keys *storageKeys.Scheme, keyring *envelope.Keyring) core.DataStorage {
+	return &encryptedStorage{
+		dataStorage,
+		keys,
+		keyring,
+	}
+}
+
+func (s *encryptedStorage) SaveImageAsync(
+	file []byte,
+	originalImageName string,
+	image storageKeys.ImageRef,
+	formats []string,
+	options core.ConversionOptions,
+) (*contracts.ConversionJob, error) {
+	key := originalKey(s.keys, image, originalImageName)
+	encrypted, err := s.keyring.Encrypt(key, file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.DataStorage.SaveImageAsync(encrypted, originalImageName, image, formats, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if job.OriginalImageName != key {
+		s.DataStorage.DeleteFile(job.OriginalImageName)
+		return nil, errors.New(fmt.Sprintf("The original was stored under %s instead of %s", job.OriginalImageName, key))
+	}
+
+	return job, nil
+}
+
+func (s *encryptedStorage) GetFile(name string) ([]byte, error) {
+	file, err := s.DataStorage.GetFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.keyring.Decrypt(name, file)
+}
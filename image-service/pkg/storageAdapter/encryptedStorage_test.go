@@ -0,0 +1,160 @@
+package storageAdapter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"image-common/pkg/blob"
+	"image-common/pkg/envelope"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"testing"
+)
+
+func newKeyring(t *testing.T, currentId string, ids ...string) *envelope.Keyring {
+	keys := make(map[string][]byte)
+
+	for _, id := range append(ids, currentId) {
+		key := sha256.Sum256([]byte(id))
+		keys[id] = key[:]
+	}
+
+	keyring, err := envelope.NewKeyring(currentId, keys)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	keyring := newKeyring(t, "2023-01")
+
+	conformance.RunDataStorage(t, func(t *testing.T) core.DataStorage {
+		return NewEncryptedStorage(NewStorageAdapter(blob.NewMemory(), storageKeys.Flat(), nil), storageKeys.Flat(), keyring)
+	})
+
+	store := blob.NewMemory()
+	storage := NewEncryptedStorage(NewStorageAdapter(store, storageKeys.Flat(), nil), storageKeys.Flat(), keyring)
+	file := conformance.NewPng(t, 8, 8)
+
+	job, err := storage.SaveImageAsync(file, "upload.png", conformance.NewImageRef(), []string{"webp"}, core.ConversionOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Get(job.OriginalImageName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !envelope.IsEncrypted(stored) || bytes.Contains(stored, file[:16]) {
+		t.Error("expected the original to be stored encrypted")
+	}
+
+	// an encrypted file copied over another original
+	other := storageKeys.Flat().Original(conformance.NewImageRef(), "png")
+	store.Put(other, stored)
+
+	if _, err := storage.GetFile(other); !errors.Is(err, envelope.ErrCorrupted) {
+		t.Errorf("expected a file moved to another key to fail authentication, got %v", err)
+	}
+
+	stored[len(stored)-1] ^= 1
+
+	if _, err := keyring.Decrypt(job.OriginalImageName, stored); !errors.Is(err, envelope.ErrCorrupted) {
+		t.Errorf("expected a tampered file to fail authentication, got %v", err)
+	}
+}
+
+func TestRotateEncryptionKeys(t *testing.T) {
+	store := blob.NewMemory()
+	keys := storageKeys.Flat()
+	file := conformance.NewPng(t, 8, 8)
+	oldKeyring := newKeyring(t, "2023-01")
+
+	job, err := NewEncryptedStorage(NewStorageAdapter(store, keys, nil), keys, oldKeyring).
+		SaveImageAsync(file, "upload.png", conformance.NewImageRef(), []string{"webp"}, core.ConversionOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stored before the encryption was enabled
+	store.Put(keys.Original(conformance.NewImageRef(), "png"), file)
+
+	rotatedKeyring := newKeyring(t, "2023-07", "2023-01")
+
+	if _, err := rotatedKeyring.Decrypt(job.OriginalImageName, file); err != nil {
+		t.Errorf("expected a clear file to be read as it is: %s", err)
+	}
+
+	stats, err := RotateEncryptionKeys(store, keys, nil, rotatedKeyring)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats != (EncryptionKeyRotationStats{Rewrapped: 1, Clear: 1}) {
+		t.Errorf("expected 1 rewrapped and 1 clear original, got %+v", stats)
+	}
+
+	stored, err := store.Get(job.OriginalImageName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := oldKeyring.Decrypt(job.OriginalImageName, stored); !errors.Is(err, envelope.ErrUnknownKey) {
+		t.Errorf("expected the old key not to be used anymore, got %v", err)
+	}
+
+	if decrypted, err := newKeyring(t, "2023-07").Decrypt(job.OriginalImageName, stored); err != nil || !bytes.Equal(decrypted, file) {
+		t.Errorf("expected the original to decrypt with the new key alone, got %v", err)
+	}
+
+	stats, err = RotateEncryptionKeys(store, keys, nil, rotatedKeyring)
+
+	if err != nil || stats != (EncryptionKeyRotationStats{Current: 1, Clear: 1}) {
+		t.Errorf("expected the original to be under the current key already, got %+v, %v", stats, err)
+	}
+}
+
+// convertingStore deletes the originals once read, as image-saver converting
+// them during the rotation.
+type convertingStore struct {
+	*blob.Memory
+}
+
+func (s convertingStore) Get(key string) ([]byte, error) {
+	data, err := s.Memory.Get(key)
+	s.Memory.Delete(key)
+
+	return data, err
+}
+
+func TestRotateEncryptionKeysConvertedOriginal(t *testing.T) {
+	store := convertingStore{blob.NewMemory()}
+	keys := storageKeys.Flat()
+
+	_, err := NewEncryptedStorage(NewStorageAdapter(store, keys, nil), keys, newKeyring(t, "2023-01")).
+		SaveImageAsync(conformance.NewPng(t, 8, 8), "upload.png", conformance.NewImageRef(), []string{"webp"}, core.ConversionOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := RotateEncryptionKeys(store, keys, nil, newKeyring(t, "2023-07", "2023-01"))
+
+	if err != nil || stats != (EncryptionKeyRotationStats{Vanished: 1}) {
+		t.Fatalf("expected the converted original to be skipped, got %+v, %v", stats, err)
+	}
+
+	if stored, _ := store.List(""); len(stored) != 0 {
+		t.Errorf("expected the converted original not to be written again, got %v", stored)
+	}
+}
@@ -0,0 +1,100 @@
+package storageAdapter
+
+import (
+	"errors"
+	"image-common/pkg/blob"
+	"image-common/pkg/envelope"
+	"image-common/pkg/storageKeys"
+)
+
+type EncryptionKeyRotationStats struct {
+	Rewrapped int
+	// Current originals are already under the current key.
+	Current int
+	// Clear originals were stored before the encryption was enabled.
+	Clear int
+	// Vanished originals were deleted by image-saver during the rotation.
+	Vanished int
+}
+
+// RotateEncryptionKeys encrypts the originals in the layouts of keys and
+// previousKeys again under the current key-encryption key, so that the other
+// keys can be removed from the keyring afterwards. image-saver deletes the
+// originals once converted, an original deleted before it is written again
+// is skipped. One deleted in between is written again, and is then reported
+// as a leftover original by the consistency check.
+func RotateEncryptionKeys(
+	store blob.Store,
+	keys *storageKeys.Scheme,
+	previousKeys *storageKeys.Scheme,
+	keyring *envelope.Keyring,
+) (EncryptionKeyRotationStats, error) {
+	var stats EncryptionKeyRotationStats
+
+	schemes := []*storageKeys.Scheme{keys}
+
+	if previousKeys != nil {
+		schemes = append(schemes, previousKeys)
+	}
+
+	storedKeys, err := listSchemeKeys(store, schemes)
+
+	if err != nil {
+		return stats, err
+	}
+
+	for _, key := range storedKeys {
+		if parsed, ok := parseKey(schemes, key); !ok || parsed.Kind != storageKeys.KindOriginal {
+			continue
+		}
+
+		file, err := store.Get(key)
+
+		// converted meanwhile
+		if errors.Is(err, blob.ErrNotFound) {
+			stats.Vanished++
+			continue
+		}
+
+		if err != nil {
+			return stats, err
+		}
+
+		if !envelope.IsEncrypted(file) {
+			stats.Clear++
+			continue
+		}
+
+		rewrapped, ok, err := keyring.Rewrap(key, file)
+
+		if err != nil {
+			return stats, err
+		}
+
+		if !ok {
+			stats.Current++
+			continue
+		}
+
+		// the store has no conditional writes, checking again narrows the
+		// window for recreating an original converted while it was encrypted
+		exists, err := store.Exists(key)
+
+		if err != nil {
+			return stats, err
+		}
+
+		if !exists {
+			stats.Vanished++
+			continue
+		}
+
+		if err := store.Put(key, rewrapped); err != nil {
+			return stats, err
+		}
+
+		stats.Rewrapped++
+	}
+
+	return stats, nil
+}
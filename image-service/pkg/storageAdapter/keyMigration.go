@@ -0,0 +1,108 @@
+package storageAdapter
+
+import (
+	"errors"
+	"image-common/pkg/blob"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/core"
+)
+
+type KeyMigrationStats struct {
+	Moved int
+	// Skipped files are already under their new key, or are masters of
+	// formats that are not watermarked.
+	Skipped int
+	// Missing variants are under neither key.
+	Missing int
+}
+
+// MigrateImageKeys moves the variants and masters of image from the layout
+// of from to the one of to. It can be run again after an interruption, and
+// a file written under the new key meanwhile is never replaced by the old
+// one. Originals are left alone: the jobs waiting for them carry their keys.
+func MigrateImageKeys(
+	store blob.Store,
+	from *storageKeys.Scheme,
+	to *storageKeys.Scheme,
+	image core.ImageEntity,
+	dryRun bool,
+	stats *KeyMigrationStats,
+) error {
+	ref := storageKeys.ImageRef{Id: image.Id, CreatedDate: image.CreatedDate}
+
+	for _, keys := range []*storageKeys.Scheme{from, to} {
+		if err := keys.Check(ref); err != nil {
+			return err
+		}
+	}
+
+	for _, format := range image.AvailableFormats {
+		found, err := moveFile(store, from.Variant(ref, format), to.Variant(ref, format), dryRun, stats)
+
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			stats.Missing++
+		}
+
+		found, err = moveFile(store, from.Master(ref, format), to.Master(ref, format), dryRun, stats)
+
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			stats.Skipped++
+		}
+	}
+
+	return nil
+}
+
+// moveFile returns false when the file is under neither key.
+func moveFile(store blob.Store, fromKey string, toKey string, dryRun bool, stats *KeyMigrationStats) (bool, error) {
+	movedBefore, err := store.Exists(toKey)
+
+	if err != nil {
+		return false, err
+	}
+
+	if movedBefore {
+		stats.Skipped++
+
+		if fromKey == toKey || dryRun {
+			return true, nil
+		}
+
+		// the stale copy left by an interrupted run
+		return true, store.Delete(fromKey)
+	}
+
+	if fromKey == toKey {
+		return false, nil
+	}
+
+	file, err := store.Get(fromKey)
+
+	if errors.Is(err, blob.ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	stats.Moved++
+
+	if dryRun {
+		return true, nil
+	}
+
+	if err := store.Put(toKey, file); err != nil {
+		return false, err
+	}
+
+	return true, store.Delete(fromKey)
+}
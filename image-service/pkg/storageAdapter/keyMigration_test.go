@@ -0,0 +1,83 @@
+package storageAdapter
+
+import (
+	"image-common/pkg/blob"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"testing"
+)
+
+func TestMigrateImageKeys(t *testing.T) {
+	store := blob.NewMemory()
+	flat := storageKeys.Flat()
+	sharded, err := storageKeys.NewScheme(layouts["Hash"])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imageRef := conformance.NewImageRef()
+	image := core.ImageEntity{Id: imageRef.Id, CreatedDate: imageRef.CreatedDate, AvailableFormats: []string{"png", "jpg", "webp"}}
+
+	err = NewStorageAdapter(store, flat, nil).SaveImage(conformance.NewPng(t, 8, 8), imageRef, []string{"png", "jpg"}, core.ConversionOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Put(flat.Master(imageRef, "jpg"), []byte("master"))
+
+	// reads fall back to the previous layout until the files are moved
+	migrating := NewStorageAdapter(store, sharded, flat)
+
+	if _, err := migrating.GetImageFile(imageRef, "png"); err != nil {
+		t.Fatalf("expected the file to be read from the previous layout: %s", err)
+	}
+
+	var dryRunStats KeyMigrationStats
+
+	if err := MigrateImageKeys(store, flat, sharded, image, true, &dryRunStats); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := store.Exists(sharded.Variant(imageRef, "png")); exists {
+		t.Error("expected the dry run to leave the files alone")
+	}
+
+	var stats KeyMigrationStats
+
+	if err := MigrateImageKeys(store, flat, sharded, image, false, &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := KeyMigrationStats{Moved: 3, Skipped: 2, Missing: 1}
+
+	if stats != expected || dryRunStats != expected {
+		t.Errorf("expected %+v, got %+v and %+v for the dry run", expected, stats, dryRunStats)
+	}
+
+	if keys, _ := store.List(""); len(keys) != 3 {
+		t.Errorf("expected only the 3 moved files to be left, got %v", keys)
+	}
+
+	for _, format := range []string{"png", "jpg"} {
+		if _, err := NewStorageAdapter(store, sharded, nil).GetImageFile(imageRef, format); err != nil {
+			t.Errorf("expected the %s variant under the new key: %s", format, err)
+		}
+	}
+
+	if master, err := store.Get(sharded.Master(imageRef, "jpg")); err != nil || string(master) != "master" {
+		t.Errorf("expected the master under the new key, got %q, %v", master, err)
+	}
+
+	var rerunStats KeyMigrationStats
+
+	if err := MigrateImageKeys(store, flat, sharded, image, false, &rerunStats); err != nil {
+		t.Fatal(err)
+	}
+
+	if rerunStats.Moved != 0 || rerunStats.Skipped != 5 {
+		t.Errorf("expected everything to be skipped the second time, got %+v", rerunStats)
+	}
+}
@@ -0,0 +1,229 @@
+package storageAdapter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image-common/pkg/blob"
+	"image-common/pkg/codec"
+	"image-common/pkg/contracts"
+	"image-common/pkg/imaging"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/core"
+	"image-service/pkg/utils"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"time"
+
+	"github.com/google/uuid"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+var codecs *codec.Registry = codec.NewRegistry(
+	codec.NewJpegCodec(),
+	codec.NewPngCodec(),
+)
+
+type storageAdapter struct {
+	store blob.Store
+	keys  *storageKeys.Scheme
+	// previousKeys is the layout files are read from and deleted in as well
+	// while they are being moved to keys, nil otherwise
+	previousKeys *storageKeys.Scheme
+}
+
+func NewStorageAdapter(store blob.Store, keys *storageKeys.Scheme, previousKeys *storageKeys.Scheme) core.DataStorage {
+	return &storageAdapter{
+		store,
+		keys,
+		previousKeys,
+	}
+}
+
+func (s *storageAdapter) GetFile(name string) ([]byte, error) {
+	return s.store.Get(name)
+}
+
+func (s *storageAdapter) GetImageFile(image storageKeys.ImageRef, format string) ([]byte, error) {
+	return s.getWithFallback(image, func(keys *storageKeys.Scheme) string {
+		return keys.Variant(image, format)
+	})
+}
+
+func (s *storageAdapter) GetImageMasterFile(image storageKeys.ImageRef, format string) ([]byte, error) {
+	return s.getWithFallback(image, func(keys *storageKeys.Scheme) string {
+		return keys.Master(image, format)
+	})
+}
+
+func (s *storageAdapter) DatedKeys() bool {
+	return s.keys.Dated() || (s.previousKeys != nil && s.previousKeys.Dated())
+}
+
+func (s *storageAdapter) getWithFallback(image storageKeys.ImageRef, key func(keys *storageKeys.Scheme) string) ([]byte, error) {
+	if err := s.keys.Check(image); err != nil {
+		return nil, err
+	}
+
+	file, err := s.store.Get(key(s.keys))
+
+	if s.previousKeys == nil || !errors.Is(err, blob.ErrNotFound) {
+		return file, err
+	}
+
+	return s.store.Get(key(s.previousKeys))
+}
+
+func (s *storageAdapter) SaveImageAsync(
+	file []byte,
+	originalImageName string,
+	image storageKeys.ImageRef,
+	formats []string,
+	options core.ConversionOptions,
+) (*contracts.ConversionJob, error) {
+	if err := s.keys.Check(image); err != nil {
+		return nil, err
+	}
+
+	originalImageSaveName := originalKey(s.keys, image, originalImageName)
+
+	err := s.store.Put(originalImageSaveName, file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var supportedFormatsToSave []string = make([]string, 0)
+
+	for _, format := range formats {
+		if f, prs := codec.FormatByExtension(format); prs && f.Capabilities.Encode {
+			supportedFormatsToSave = append(supportedFormatsToSave, format)
+		} else {
+			fmt.Println(fmt.Sprintf("Формат %s не поддерживается", format))
+		}
+	}
+
+	return conversionJob(originalImageSaveName, image, supportedFormatsToSave, options), nil
+}
+
+func (s *storageAdapter) SaveImage(file []byte, image storageKeys.ImageRef, formats []string, options core.ConversionOptions) error {
+	if err := s.keys.Check(image); err != nil {
+		return err
+	}
+
+	for _, format := range formats {
+		if _, prs := codecs.Lookup(format); prs {
+			s.saveImageFormat(file, s.keys.Variant(image, format), format, options)
+		} else {
+			fmt.Println(fmt.Sprintf("Формат %s не поддерживается", format))
+		}
+	}
+
+	return nil
+}
+
+func (s *storageAdapter) DeleteImage(image storageKeys.ImageRef, formats []string) error {
+	for _, keys := range []*storageKeys.Scheme{s.keys, s.previousKeys} {
+		if keys == nil {
+			continue
+		}
+
+		if err := keys.Check(image); err != nil {
+			return err
+		}
+
+		for _, format := range formats {
+			err := s.DeleteFile(keys.Variant(image, format))
+
+			if err != nil {
+				fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the original image file", err))
+			}
+
+			err = s.DeleteFile(keys.Master(image, format))
+
+			if err != nil {
+				fmt.Println(fmt.Sprintf("%s: %s", "Failed to delete the master image file", err))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *storageAdapter) DeleteFile(name string) error {
+	return s.store.Delete(name)
+}
+
+func (s *storageAdapter) saveImageFormat(file []byte, key string, format string, options core.ConversionOptions) error {
+	imgBuf := bytes.NewBuffer(file)
+	imgDecoded, _, err := image.Decode(imgBuf)
+
+	if err != nil {
+		return err
+	}
+
+	encoder, err := codecs.Encoder(format)
+
+	if err != nil {
+		return err
+	}
+
+	var encodedBuf bytes.Buffer
+
+	if options.CropAspectRatio != nil {
+		aspectRatio, err := imaging.ParseAspectRatio(*options.CropAspectRatio)
+
+		if err != nil {
+			return err
+		}
+
+		imgDecoded = imaging.CropToAspect(imgDecoded, aspectRatio, options.FocalPoint)
+	}
+
+	imgResized := imaging.Fit(imgDecoded, utils.IntValue(options.MaxWidth), utils.IntValue(options.MaxHeight))
+
+	err = encoder.Encode(&encodedBuf, imgResized, codec.OptionsForFormat(options.EncodeOptions, format))
+
+	if err != nil {
+		return err
+	}
+
+	return s.store.Put(key, encodedBuf.Bytes())
+}
+
+func originalKey(keys *storageKeys.Scheme, image storageKeys.ImageRef, originalImageName string) string {
+	return keys.Original(image, codec.Extension(originalImageName))
+}
+
+func conversionJob(
+	originalImageName string,
+	image storageKeys.ImageRef,
+	saveFormats []string,
+	options core.ConversionOptions,
+) *contracts.ConversionJob {
+	var imageCreatedDate *time.Time
+
+	if !image.CreatedDate.IsZero() {
+		imageCreatedDate = &image.CreatedDate
+	}
+
+	return &contracts.ConversionJob{
+		Version:           contracts.ConversionJobVersion,
+		JobId:             uuid.New().String(),
+		OriginalImageName: originalImageName,
+		SaveName:          image.Id,
+		SaveFormats:       saveFormats,
+		EncodeOptions:     options.EncodeOptions,
+		Animation:         utils.StringValue(options.Animation),
+		MaxWidth:          utils.IntValue(options.MaxWidth),
+		MaxHeight:         utils.IntValue(options.MaxHeight),
+		CropAspectRatio:   utils.StringValue(options.CropAspectRatio),
+		FocalPoint:        options.FocalPoint,
+		Priority:          utils.StringValue(options.Priority),
+		ImageCreatedDate:  imageCreatedDate,
+	}
+}
@@ -0,0 +1,222 @@
+package storageAdapter
+
+import (
+	"errors"
+	"image-common/pkg/blob"
+	"image-common/pkg/storageKeys"
+	"image-service/pkg/conformance"
+	"image-service/pkg/core"
+	"os"
+	"testing"
+)
+
+var layouts = map[string]storageKeys.Config{
+	"Flat": {},
+	"Hash": {
+		Prefix:          "tenant",
+		Sharding:        storageKeys.ShardingHash,
+		OriginalsPrefix: "originals",
+		VariantSubpaths: true,
+	},
+	"Date": {Sharding: storageKeys.ShardingDate},
+}
+
+func TestFilesystemStorage(t *testing.T) {
+	for name, config := range layouts {
+		keys, err := storageKeys.NewScheme(config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			conformance.RunDataStorage(t, func(t *testing.T) core.DataStorage {
+				store, err := blob.NewFileStore(t.TempDir())
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return NewStorageAdapter(store, keys, nil)
+			})
+		})
+	}
+}
+
+func TestReplicatedStorage(t *testing.T) {
+	conformance.RunDataStorage(t, func(t *testing.T) core.DataStorage {
+		return NewStorageAdapter(blob.NewReplicated(blob.NewMemory(), blob.NewMemory()), storageKeys.Flat(), nil)
+	})
+
+	primary := &unavailableStore{Store: blob.NewMemory()}
+	secondary := &unavailableStore{Store: blob.NewMemory()}
+	replicated := blob.NewReplicated(primary, secondary)
+	storage := NewStorageAdapter(replicated, storageKeys.Flat(), nil)
+	imageRef := conformance.NewImageRef()
+
+	if err := storage.SaveImage(conformance.NewPng(t, 8, 8), imageRef, []string{"png"}, core.ConversionOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := storageKeys.Flat().Variant(imageRef, "png")
+
+	if exists, _ := secondary.Exists(key); !exists {
+		t.Fatal("expected the file to be written to the secondary")
+	}
+
+	primary.unavailable = true
+
+	if _, err := storage.GetImageFile(imageRef, "png"); err != nil {
+		t.Errorf("expected the file to be read from the secondary: %s", err)
+	}
+
+	primary.unavailable = false
+	secondary.Delete(key)
+
+	if _, err := storage.GetImageFile(imageRef, "png"); err != nil {
+		t.Errorf("expected the file to be read from the primary: %s", err)
+	}
+
+	primary.Delete(key)
+
+	if _, err := storage.GetImageFile(imageRef, "png"); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("expected a file missing from the primary not to be read from the secondary, got %v", err)
+	}
+
+	secondary.unavailable = true
+
+	if err := storage.SaveImage(conformance.NewPng(t, 8, 8), imageRef, []string{"png"}, core.ConversionOptions{}); err != nil {
+		t.Fatalf("expected a write failing on the secondary to succeed, got %s", err)
+	}
+
+	if pending := replicated.PendingRepairs(); pending != 1 {
+		t.Fatalf("expected 1 pending repair, got %d", pending)
+	}
+
+	replicated.Repair()
+
+	if pending := replicated.PendingRepairs(); pending != 1 {
+		t.Errorf("expected the repair to stay pending while the secondary is unavailable, got %d", pending)
+	}
+
+	secondary.unavailable = false
+	replicated.Repair()
+
+	if exists, _ := secondary.Exists(key); !exists || replicated.PendingRepairs() != 0 {
+		t.Error("expected the repair to copy the file to the secondary")
+	}
+
+	secondary.unavailable = true
+
+	if err := storage.DeleteImage(imageRef, []string{"png"}); err != nil {
+		t.Fatalf("expected a delete failing on the secondary to succeed, got %s", err)
+	}
+
+	secondary.unavailable = false
+	replicated.Repair()
+
+	if exists, _ := secondary.Exists(key); exists {
+		t.Error("expected the repair to delete the file from the secondary")
+	}
+}
+
+// unavailableStore fails every call while unavailable, as a store that can't
+// be reached.
+type unavailableStore struct {
+	blob.Store
+	unavailable bool
+}
+
+var errUnavailable = errors.New("store unavailable")
+
+func (s *unavailableStore) Get(key string) ([]byte, error) {
+	if s.unavailable {
+		return nil, errUnavailable
+	}
+
+	return s.Store.Get(key)
+}
+
+func (s *unavailableStore) Put(key string, data []byte) error {
+	if s.unavailable {
+		return errUnavailable
+	}
+
+	return s.Store.Put(key, data)
+}
+
+func (s *unavailableStore) Delete(key string) error {
+	if s.unavailable {
+		return errUnavailable
+	}
+
+	return s.Store.Delete(key)
+}
+
+func (s *unavailableStore) Exists(key string) (bool, error) {
+	if s.unavailable {
+		return false, errUnavailable
+	}
+
+	return s.Store.Exists(key)
+}
+
+func TestParseKeys(t *testing.T) {
+	imageRef := conformance.NewImageRef()
+
+	for name, config := range layouts {
+		keys, err := storageKeys.NewScheme(config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]storageKeys.Key{
+			keys.Variant(imageRef, "webp"):  {Kind: storageKeys.KindVariant, Id: imageRef.Id, Format: "webp"},
+			keys.Master(imageRef, "jpg"):    {Kind: storageKeys.KindMaster, Id: imageRef.Id, Format: "jpg"},
+			keys.Original(imageRef, "png"):  {Kind: storageKeys.KindOriginal, Id: imageRef.Id, Format: "png"},
+			keys.JobMarker("jobId", "avif"): {Kind: storageKeys.KindJobMarker, Id: "jobId", Format: "avif"},
+		}
+
+		for key, want := range expected {
+			if parsed, ok := keys.Parse(key); !ok || parsed != want {
+				t.Errorf("%s: expected %s to be read as %+v, got %+v, %v", name, key, want, parsed, ok)
+			}
+		}
+
+		for _, key := range []string{"notes/readme.txt", keys.Root() + imageRef.Id, keys.Variant(imageRef, "webp") + "/image.png"} {
+			if parsed, ok := keys.Parse(key); ok {
+				t.Errorf("%s: expected %s not to be read, got %+v", name, key, parsed)
+			}
+		}
+	}
+}
+
+// TestS3Storage runs against the bucket named by TestS3Bucket, for example
+// the one of the docker-compose minio.
+func TestS3Storage(t *testing.T) {
+	bucket := os.Getenv("TestS3Bucket")
+
+	if bucket == "" {
+		t.Skip("TestS3Bucket is not set")
+	}
+
+	store := blob.NewS3Store(blob.S3Config{
+		Bucket:          bucket,
+		AccessKeyId:     os.Getenv("TestS3AccessKeyId"),
+		SecretAccessKey: os.Getenv("TestS3SecretAccessKey"),
+		Endpoint:        getEnvOrDefault("TestS3Endpoint", "http://localhost:9000"),
+	})
+
+	conformance.RunDataStorage(t, func(t *testing.T) core.DataStorage {
+		return NewStorageAdapter(store, storageKeys.Flat(), nil)
+	})
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	if value, prs := os.LookupEnv(key); prs && value != "" {
+		return value
+	}
+
+	return defaultValue
+}
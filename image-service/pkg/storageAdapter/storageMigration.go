@@ -0,0 +1,149 @@
+package storageAdapter
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image-common/pkg/blob"
+	"sort"
+)
+
+type StorageMigrationStats struct {
+	Copied int
+	// Verified files were already on the destination with the same checksum,
+	// written by the replication or by an earlier run.
+	Verified int
+	// Vanished files were deleted from the source during the migration.
+	Vanished int
+}
+
+const storageMigrationCheckpointInterval = 100
+
+// MigrateStorage copies every file of source to the destinations in key
+// order, starting after afterKey, and reads every copy back to compare its
+// checksum. checkpoint is called with the last key done every hundred files
+// and at the end, a later run can start after it. The services are expected
+// to replicate their writes to the destinations meanwhile: a file rewritten
+// or deleted on the source while it is copied is copied again or deleted.
+func MigrateStorage(
+	source blob.Store,
+	destinations []blob.Store,
+	afterKey string,
+	checkpoint func(key string, stats StorageMigrationStats) error,
+) (StorageMigrationStats, error) {
+	var stats StorageMigrationStats
+
+	keys, err := source.List("")
+
+	if err != nil {
+		return stats, err
+	}
+
+	sort.Strings(keys)
+
+	lastKey := afterKey
+
+	for i, key := range keys {
+		if key <= afterKey {
+			continue
+		}
+
+		if err := migrateFile(source, destinations, key, &stats); err != nil {
+			return stats, err
+		}
+
+		lastKey = key
+
+		if (i+1)%storageMigrationCheckpointInterval == 0 {
+			if err := checkpoint(lastKey, stats); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	return stats, checkpoint(lastKey, stats)
+}
+
+func migrateFile(source blob.Store, destinations []blob.Store, key string, stats *StorageMigrationStats) error {
+	data, err := source.Get(key)
+
+	for {
+		if errors.Is(err, blob.ErrNotFound) {
+			stats.Vanished++
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var fileStats StorageMigrationStats
+
+		for _, destination := range destinations {
+			if err := copyFile(destination, key, data, &fileStats); err != nil {
+				return err
+			}
+		}
+
+		current, err := source.Get(key)
+
+		if errors.Is(err, blob.ErrNotFound) {
+			// the copies must not outlive the file
+			for _, destination := range destinations {
+				if err := destination.Delete(key); err != nil {
+					return err
+				}
+			}
+
+			stats.Vanished++
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// otherwise the copies may be of the previous version, the content is
+		// compared since a rewrite can keep the modification time of a backend
+		// with a coarse resolution
+		if len(current) == len(data) && sha256.Sum256(current) == sha256.Sum256(data) {
+			stats.Copied += fileStats.Copied
+			stats.Verified += fileStats.Verified
+			return nil
+		}
+
+		data = current
+	}
+}
+
+func copyFile(destination blob.Store, key string, data []byte, stats *StorageMigrationStats) error {
+	checksum := sha256.Sum256(data)
+	existing, err := destination.Get(key)
+
+	if err == nil && sha256.Sum256(existing) == checksum {
+		stats.Verified++
+		return nil
+	}
+
+	if err != nil && !errors.Is(err, blob.ErrNotFound) {
+		return err
+	}
+
+	if err := destination.Put(key, data); err != nil {
+		return err
+	}
+
+	copied, err := destination.Get(key)
+
+	if err != nil {
+		return err
+	}
+
+	if sha256.Sum256(copied) != checksum {
+		return errors.New(fmt.Sprintf("The copy of %s doesn't match its checksum", key))
+	}
+
+	stats.Copied++
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package storageAdapter
+
+import (
+	"errors"
+	"fmt"
+	"image-common/pkg/blob"
+	"reflect"
+	"testing"
+)
+
+type corruptingStore struct {
+	*blob.Memory
+}
+
+func (s corruptingStore) Put(key string, data []byte) error {
+	return s.Memory.Put(key, append(data, 0))
+}
+
+func TestMigrateStorage(t *testing.T) {
+	source, destination := blob.NewMemory(), blob.NewMemory()
+
+	for i := 0; i < 250; i++ {
+		source.Put(fmt.Sprintf("%03d.png", i), []byte(fmt.Sprintf("image %d", i)))
+	}
+
+	// written by the replication, and left stale by a failed write
+	destination.Put("000.png", []byte("image 0"))
+	destination.Put("001.png", []byte("stale"))
+
+	interrupted := errors.New("interrupted")
+	var checkpoints []string
+
+	_, err := MigrateStorage(source, []blob.Store{destination}, "", func(key string, stats StorageMigrationStats) error {
+		checkpoints = append(checkpoints, key)
+		return interrupted
+	})
+
+	if !errors.Is(err, interrupted) || !reflect.DeepEqual(checkpoints, []string{"099.png"}) {
+		t.Fatalf("expected the run to stop at the first checkpoint, got %v, %v", checkpoints, err)
+	}
+
+	stats, err := MigrateStorage(source, []blob.Store{destination}, checkpoints[0], func(key string, stats StorageMigrationStats) error {
+		checkpoints = append(checkpoints, key)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := StorageMigrationStats{Copied: 150}
+
+	if stats != expected || checkpoints[len(checkpoints)-1] != "249.png" {
+		t.Errorf("expected %+v up to 249.png, got %+v up to %v", expected, stats, checkpoints)
+	}
+
+	for i := 0; i < 250; i++ {
+		key := fmt.Sprintf("%03d.png", i)
+
+		if data, err := destination.Get(key); err != nil || string(data) != fmt.Sprintf("image %d", i) {
+			t.Fatalf("expected %s to be copied, got %q, %v", key, data, err)
+		}
+	}
+
+	stats, err = MigrateStorage(source, []blob.Store{destination}, "", func(key string, stats StorageMigrationStats) error {
+		return nil
+	})
+
+	if err != nil || stats != (StorageMigrationStats{Verified: 250}) {
+		t.Errorf("expected every copy to be verified, got %+v, %v", stats, err)
+	}
+
+	_, err = MigrateStorage(source, []blob.Store{corruptingStore{blob.NewMemory()}}, "", func(key string, stats StorageMigrationStats) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Error("expected the corrupted copy to fail the checksum")
+	}
+}
+
+// rewritingStore rewrites the file on the source while it is copied, as an
+// upload replaced during the migration.
+type rewritingStore struct {
+	*blob.Memory
+	source    blob.Store
+	rewritten bool
+}
+
+func (s *rewritingStore) Put(key string, data []byte) error {
+	if !s.rewritten {
+		s.rewritten = true
+		s.source.Put(key, []byte("image 1"))
+	}
+
+	return s.Memory.Put(key, data)
+}
+
+func TestMigrateStorageRewrittenFile(t *testing.T) {
+	source := blob.NewMemory()
+	source.Put("000.png", []byte("image 0"))
+	destination := &rewritingStore{Memory: blob.NewMemory(), source: source}
+
+	stats, err := MigrateStorage(source, []blob.Store{destination}, "", func(key string, stats StorageMigrationStats) error {
+		return nil
+	})
+
+	if err != nil || stats != (StorageMigrationStats{Copied: 1}) {
+		t.Fatalf("expected the file to be copied, got %+v, %v", stats, err)
+	}
+
+	if data, _ := destination.Get("000.png"); string(data) != "image 1" {
+		t.Errorf("expected the rewritten file to be copied again, got %q", data)
+	}
+}
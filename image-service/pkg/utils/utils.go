@@ -3,3 +3,19 @@ package utils
 func BoolPointer(b bool) *bool {
 	return &b
 }
+
+func IntValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+
+	return *i
+}
+
+func StringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}